@@ -6,3 +6,5 @@ require (
 	github.com/confluentinc/confluent-kafka-go v1.9.2
 	github.com/spdeepak/flowtracker v0.0.3
 )
+
+replace github.com/spdeepak/flowtracker => ../../
@@ -1,12 +1,16 @@
 package confluent_kafka
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/spdeepak/flowtracker"
+	"github.com/spdeepak/flowtracker/exporters"
 )
 
 // Config holds the setup parameters.
@@ -23,14 +27,61 @@ type Config struct {
 	// Use this if you don't have an existing client.
 	// Example: &kafka.ConfigMap{"bootstrap.servers": "localhost:9092"}
 	KafkaConfigMap *kafka.ConfigMap
+
+	// KeyAttribute names a trace attribute (see flowtracker.SetTraceAttr) used as the message key,
+	// e.g. "tenant" to keep all traces of a tenant on the same partition.
+	// Falls back to the TraceID when empty or when the trace doesn't carry the attribute.
+	KeyAttribute string
+
+	// HeaderAttributes lists trace attributes copied into the message headers,
+	// so consumers can filter without decoding the payload.
+	HeaderAttributes []string
+
+	// OnDelivery is called with the delivery report of every message, successful or not.
+	// A failed delivery has msg.TopicPartition.Error set.
+	OnDelivery func(msg *kafka.Message)
+
+	// OnError is called for every trace or message that could not be sent, and for
+	// errors reported by a producer created from KafkaConfigMap.
+	// Default: log.Printf
+	OnError func(err error)
+
+	// MaxMessageBytes limits the size of a message payload. Default: exporters.DefaultMaxMessageBytes
+	MaxMessageBytes int
+
+	// Oversize is applied to traces whose payload exceeds MaxMessageBytes. Default: exporters.OversizeDrop
+	Oversize exporters.OversizeStrategy
+
+	// SpanPerMessage sends one exporters.SpanMessage per span instead of one message per trace.
+	// All spans of a trace share the same key. A span that doesn't fit MaxMessageBytes is dropped.
+	SpanPerMessage bool
 }
 
+// ErrClosed is reported through OnError for traces exported after Close.
+var ErrClosed = errors.New("kafka exporter: closed")
+
 // KafkaExporter implements the flowtracker.Exporter interface.
 type KafkaExporter struct {
 	producer *kafka.Producer
 	topic    string
+	// encoder builds the messages of a trace, shared with the other message broker exporters
+	encoder *exporters.MessageEncoder
 	// isOwned tracks if this exporter created the producer (and thus should close it).
 	isOwned bool
+
+	onDelivery func(*kafka.Message)
+	onError    func(error)
+	// deliveries receives the delivery reports of the messages produced by this exporter
+	deliveries chan kafka.Event
+	// pending counts the produced messages still waiting for their delivery report
+	pending atomic.Int64
+	// mu guards closed, so no message is produced once Close has started
+	mu        sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+	done      chan struct{}
+	// stopped is closed when the delivery report goroutine returns
+	stopped chan struct{}
 }
 
 // New creates a new KafkaExporter.
@@ -39,30 +90,45 @@ func New(cfg Config) (*KafkaExporter, error) {
 		return nil, fmt.Errorf("kafka exporter: topic is required")
 	}
 
-	var p *kafka.Producer
-	var err error
-	isOwned := false
+	k := &KafkaExporter{
+		topic: cfg.Topic,
+		encoder: &exporters.MessageEncoder{
+			KeyAttribute:     cfg.KeyAttribute,
+			HeaderAttributes: cfg.HeaderAttributes,
+			MaxMessageBytes:  cfg.MaxMessageBytes,
+			Oversize:         cfg.Oversize,
+			SpanPerMessage:   cfg.SpanPerMessage,
+		},
+		onDelivery: cfg.OnDelivery,
+		onError:    cfg.OnError,
+		deliveries: make(chan kafka.Event, 1000),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	if k.onError == nil {
+		k.onError = func(err error) {
+			log.Printf("FlowTracker Kafka Error: %v\n", err)
+		}
+	}
 
 	if cfg.Producer != nil {
 		// Use the user-provided producer
-		p = cfg.Producer
+		k.producer = cfg.Producer
 	} else if cfg.KafkaConfigMap != nil {
 		// Initialize a new producer
-		p, err = kafka.NewProducer(cfg.KafkaConfigMap)
+		p, err := kafka.NewProducer(cfg.KafkaConfigMap)
 		if err != nil {
 			return nil, fmt.Errorf("kafka exporter: failed to create producer: %w", err)
 		}
-		isOwned = true
+		k.producer = p
+		k.isOwned = true
 
-		// Background goroutine to handle delivery reports.
+		// Background goroutine to handle client-level errors.
 		// Essential for confluent-kafka-go to prevent local queue filling up.
 		go func() {
 			for e := range p.Events() {
-				switch ev := e.(type) {
-				case *kafka.Message:
-					if ev.TopicPartition.Error != nil {
-						log.Printf("FlowTracker Kafka Error: %v\n", ev.TopicPartition.Error)
-					}
+				if ev, ok := e.(kafka.Error); ok {
+					k.onError(ev)
 				}
 			}
 		}()
@@ -70,45 +136,127 @@ func New(cfg Config) (*KafkaExporter, error) {
 		return nil, fmt.Errorf("kafka exporter: must provide either Producer or KafkaConfigMap")
 	}
 
-	return &KafkaExporter{
-		producer: p,
-		topic:    cfg.Topic,
-		isOwned:  isOwned,
-	}, nil
+	// Delivery reports of our messages go to our own channel, so this works with a shared producer too
+	go k.handleDeliveries()
+
+	return k, nil
+}
+
+// handleDeliveries reads the delivery reports of this exporter's messages until Close.
+func (k *KafkaExporter) handleDeliveries() {
+	defer close(k.stopped)
+	for {
+		select {
+		case e := <-k.deliveries:
+			k.report(e)
+		case <-k.done:
+			if k.isOwned {
+				// The producer is closed, handle the reports that arrived before and stop
+				for {
+					select {
+					case e := <-k.deliveries:
+						k.report(e)
+					default:
+						return
+					}
+				}
+			}
+			// A shared producer keeps running and still reports the messages sent before Close.
+			// Keep reading them, a full channel would block its event loop.
+			for k.pending.Load() > 0 {
+				k.report(<-k.deliveries)
+			}
+			return
+		}
+	}
 }
 
-// Export sends the trace to Kafka.
+func (k *KafkaExporter) report(e kafka.Event) {
+	msg, ok := e.(*kafka.Message)
+	if !ok {
+		return
+	}
+	k.pending.Add(-1)
+	if msg.TopicPartition.Error != nil {
+		k.onError(fmt.Errorf("kafka exporter: delivery failed: %w", msg.TopicPartition.Error))
+	}
+	if k.onDelivery != nil {
+		k.onDelivery(msg)
+	}
+}
+
+// Dropped returns the number of traces, or single spans in SpanPerMessage and OversizeSplit mode,
+// dropped because they exceeded MaxMessageBytes.
+func (k *KafkaExporter) Dropped() uint64 {
+	return k.encoder.Dropped()
+}
+
+// Export sends the trace to Kafka. Traces exported after Close are dropped
+// and reported to OnError with ErrClosed.
 func (k *KafkaExporter) Export(tr *flowtracker.Trace) {
-	// Serialize Trace to JSON
-	payload, err := json.Marshal(tr)
-	if err != nil {
-		log.Printf("FlowTracker: failed to marshal trace: %v", err)
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.closed {
+		if tr != nil {
+			k.onError(fmt.Errorf("%w: dropped trace %s", ErrClosed, tr.TraceID))
+		}
 		return
 	}
 
+	msgs, err := k.encoder.Encode(tr)
+	if err != nil {
+		k.onError(fmt.Errorf("kafka exporter: %w", err))
+	}
+	for _, m := range msgs {
+		k.produce(m)
+	}
+}
+
+// produce sends an encoded message to the topic.
+func (k *KafkaExporter) produce(m exporters.Message) {
 	// Construct the Kafka Message
 	msg := &kafka.Message{
 		TopicPartition: kafka.TopicPartition{Topic: &k.topic, Partition: kafka.PartitionAny},
-		Value:          payload,
-		// We use the TraceID as the Key. This ensures that if you update this logic
-		// to stream updates, all spans for the same trace go to the same partition.
-		Key: []byte(tr.TraceID),
+		Value:          m.Value,
+		Key:            m.Key,
+		Headers:        make([]kafka.Header, len(m.Headers)),
+	}
+	for i, h := range m.Headers {
+		msg.Headers[i] = kafka.Header{Key: h.Key, Value: h.Value}
 	}
 
-	// Produce is asynchronous. We rely on the background event loop (started in New) to handle errors.
-	err = k.producer.Produce(msg, nil)
-	if err != nil {
-		log.Printf("FlowTracker: failed to produce message: %v", err)
+	// Produce is asynchronous. Delivery reports are handled by the goroutine started in New.
+	k.pending.Add(1)
+	if err := k.producer.Produce(msg, k.deliveries); err != nil {
+		k.pending.Add(-1)
+		k.onError(fmt.Errorf("kafka exporter: failed to produce message: %w", err))
 	}
 }
 
-// Close flushes the producer if we own it.
+// Close flushes and closes the producer if we own it. A shared producer is left open,
+// Close only waits up to 5 seconds for the delivery reports of this exporter's messages.
+// Reports arriving later are still read in the background.
+// Calling Close more than once is safe.
 // Note: The main flowtracker library doesn't call Close(), but you can call this
 // manually in your main.go shutdown hook.
 func (k *KafkaExporter) Close() {
-	if k.isOwned && k.producer != nil {
-		// Wait up to 5 seconds for outstanding messages to be delivered
-		k.producer.Flush(5000)
-		k.producer.Close()
-	}
+	k.closeOnce.Do(func() {
+		// Wait for the running exports, later ones are dropped
+		k.mu.Lock()
+		k.closed = true
+		k.mu.Unlock()
+
+		if k.isOwned {
+			// Wait up to 5 seconds for outstanding messages to be delivered
+			k.producer.Flush(5000)
+			k.producer.Close()
+		} else {
+			deadline := time.Now().Add(5 * time.Second)
+			for k.pending.Load() > 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		// Stop the delivery report goroutine once the outstanding reports are handled
+		close(k.done)
+	})
 }
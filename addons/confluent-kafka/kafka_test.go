@@ -0,0 +1,276 @@
+package confluent_kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/spdeepak/flowtracker"
+	"github.com/spdeepak/flowtracker/exporters"
+)
+
+// newTestExporter creates an exporter producing to a mock cluster and returns
+// a channel receiving its delivery reports.
+func newTestExporter(t *testing.T, cfg Config) (*KafkaExporter, chan *kafka.Message) {
+	t.Helper()
+	exp, delivered, _ := newTestExporterCluster(t, cfg)
+	return exp, delivered
+}
+
+func newTestExporterCluster(t *testing.T, cfg Config) (*KafkaExporter, chan *kafka.Message, *kafka.MockCluster) {
+	t.Helper()
+	mc := newMockCluster(t)
+	delivered := make(chan *kafka.Message, 100)
+	cfg.Topic = "traces"
+	cfg.KafkaConfigMap = &kafka.ConfigMap{
+		"bootstrap.servers": mc.BootstrapServers(),
+		// Delivery reports leave out the headers by default
+		"go.delivery.report.fields": "all",
+	}
+	cfg.OnDelivery = func(msg *kafka.Message) { delivered <- msg }
+	exp, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+	t.Cleanup(exp.Close)
+	return exp, delivered, mc
+}
+
+// nextDelivery waits for the next delivery report and fails on delivery errors.
+func nextDelivery(t *testing.T, delivered chan *kafka.Message) *kafka.Message {
+	t.Helper()
+	select {
+	case msg := <-delivered:
+		if msg.TopicPartition.Error != nil {
+			t.Fatalf("delivery failed: %v", msg.TopicPartition.Error)
+		}
+		return msg
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for delivery report")
+		return nil
+	}
+}
+
+func header(msg *kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// newTrace records a trace of the "checkout" service with n child spans,
+// each carrying a tag of tagSize bytes.
+func newTrace(t *testing.T, n, tagSize int) *flowtracker.Trace {
+	t.Helper()
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp), flowtracker.WithResource(flowtracker.Resource{ServiceName: "checkout"}))
+	ctx, end := tracer.StartTrace(context.Background(), "GET /checkout")
+	flowtracker.SetTraceAttr(ctx, "tenant", "acme")
+	for i := 0; i < n; i++ {
+		_, finish := flowtracker.StartSpan(ctx, "step "+strconv.Itoa(i))
+		flowtracker.AddTag(ctx, "payload", strings.Repeat("x", tagSize))
+		finish()
+	}
+	end()
+	return exp.next(t)
+}
+
+func TestExport_HeadersAndDelivery(t *testing.T) {
+	exp, delivered, mc := newTestExporterCluster(t, Config{HeaderAttributes: []string{"tenant"}})
+	tr := newTrace(t, 2, 10)
+	exp.Export(tr)
+	nextDelivery(t, delivered)
+
+	c, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers": mc.BootstrapServers(),
+		"group.id":          "flowtracker-test",
+		"auto.offset.reset": "earliest",
+	})
+	if err != nil {
+		t.Fatalf("failed to create consumer: %v", err)
+	}
+	defer c.Close()
+	if err := c.Subscribe("traces", nil); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	msg, err := c.ReadMessage(10 * time.Second)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(msg.Key) != tr.TraceID {
+		t.Errorf("expected the trace ID as key, got %s", msg.Key)
+	}
+	want := map[string]string{
+		exporters.HeaderServiceName:   "checkout",
+		exporters.HeaderSchemaVersion: exporters.SchemaVersion,
+		exporters.HeaderContentType:   exporters.ContentTypeTrace,
+		"tenant":                      "acme",
+	}
+	for k, v := range want {
+		if got := header(msg, k); got != v {
+			t.Errorf("expected header %s=%q, got %q", k, v, got)
+		}
+	}
+	var got flowtracker.Trace
+	if err := json.Unmarshal(msg.Value, &got); err != nil || got.TraceID != tr.TraceID || len(got.Spans) != 3 {
+		t.Errorf("unexpected payload %s (err %v)", msg.Value, err)
+	}
+}
+
+func TestExport_DeliveryError(t *testing.T) {
+	errs := make(chan error, 1)
+	exp, delivered := newTestExporter(t, Config{
+		OnError: func(err error) { errs <- err },
+	})
+	// A message larger than the producer's message.max.bytes is rejected by the client
+	exp.encoder.MaxMessageBytes = 2 << 20
+	exp.Export(newTrace(t, 1, 1<<20+100))
+
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "kafka exporter") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected OnError to be called")
+	}
+	select {
+	case msg := <-delivered:
+		t.Errorf("unexpected delivery report for a message that was never produced: %v", msg)
+	default:
+	}
+}
+
+func TestExport_OversizeDrop(t *testing.T) {
+	errs := make(chan error, 1)
+	exp, delivered := newTestExporter(t, Config{
+		MaxMessageBytes: 1000,
+		OnError:         func(err error) { errs <- err },
+	})
+	exp.Export(newTrace(t, 5, 500))
+
+	if err := <-errs; !errors.Is(err, exporters.ErrMessageTooLarge) {
+		t.Errorf("expected exporters.ErrMessageTooLarge, got %v", err)
+	}
+	if exp.Dropped() != 1 {
+		t.Errorf("expected 1 dropped trace, got %d", exp.Dropped())
+	}
+
+	// Traces that fit are still sent
+	exp.Export(newTrace(t, 1, 10))
+	nextDelivery(t, delivered)
+}
+
+func TestClose_Twice(t *testing.T) {
+	exp, _ := newTestExporter(t, Config{})
+	exp.Close()
+	exp.Close()
+}
+
+func TestClose_SharedProducer(t *testing.T) {
+	mc := newMockCluster(t)
+	p, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": mc.BootstrapServers()})
+	if err != nil {
+		t.Fatalf("failed to create producer: %v", err)
+	}
+	defer p.Close()
+
+	delivered := make(chan *kafka.Message, 1)
+	exp, err := New(Config{Topic: "traces", Producer: p, OnDelivery: func(msg *kafka.Message) { delivered <- msg }})
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+	exp.Export(newTrace(t, 1, 10))
+	exp.Close()
+	exp.Close()
+
+	// Close waits for the pending delivery report and stops the goroutine handling them
+	select {
+	case <-delivered:
+	default:
+		t.Error("expected the delivery report to be handled before Close returned")
+	}
+	select {
+	case <-exp.stopped:
+	case <-time.After(time.Second):
+		t.Error("expected the delivery report goroutine to be stopped")
+	}
+	// The shared producer is still usable
+	if err := p.Produce(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &exp.topic, Partition: kafka.PartitionAny}}, nil); err != nil {
+		t.Errorf("shared producer was closed: %v", err)
+	}
+}
+
+func TestClose_SharedProducerLateReports(t *testing.T) {
+	mc := newMockCluster(t)
+	p, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": mc.BootstrapServers()})
+	if err != nil {
+		t.Fatalf("failed to create producer: %v", err)
+	}
+	defer p.Close()
+
+	delivered := make(chan *kafka.Message, 1)
+	exp, err := New(Config{Topic: "traces", Producer: p, OnDelivery: func(msg *kafka.Message) { delivered <- msg }})
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+	// Pretend a delivery report is still outstanding when Close gives up waiting
+	exp.pending.Add(1)
+	done := make(chan struct{})
+	go func() {
+		exp.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close did not return")
+	}
+
+	// The late report is still read, so it can't block the shared producer
+	exp.deliveries <- &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &exp.topic}}
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("expected the late delivery report to be handled")
+	}
+	select {
+	case <-exp.stopped:
+	case <-time.After(time.Second):
+		t.Error("expected the delivery report goroutine to stop once no report is pending")
+	}
+}
+
+func TestExport_AfterClose(t *testing.T) {
+	errs := make(chan error, 1)
+	exp, delivered := newTestExporter(t, Config{
+		Topic:   "traces",
+		OnError: func(err error) { errs <- err },
+	})
+	exp.Close()
+	exp.Export(newTrace(t, 1, 10))
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	default:
+		t.Fatal("expected the dropped trace to be reported")
+	}
+	if exp.pending.Load() != 0 {
+		t.Errorf("expected nothing produced after Close")
+	}
+	select {
+	case <-delivered:
+		t.Error("expected no delivery after Close")
+	default:
+	}
+}
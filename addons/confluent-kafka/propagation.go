@@ -0,0 +1,86 @@
+package confluent_kafka
+
+import (
+	"context"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/spdeepak/flowtracker"
+)
+
+// headersCarrier adapts the headers of a kafka.Message to the flowtracker.Carrier interface.
+type headersCarrier struct {
+	msg *kafka.Message
+}
+
+// Get returns the last value of key, as later headers win.
+func (c headersCarrier) Get(key string) string {
+	for i := len(c.msg.Headers) - 1; i >= 0; i-- {
+		if c.msg.Headers[i].Key == key {
+			return string(c.msg.Headers[i].Value)
+		}
+	}
+	return ""
+}
+
+// Set replaces every header named key with a single one.
+func (c headersCarrier) Set(key, value string) {
+	headers := c.msg.Headers[:0]
+	for _, h := range c.msg.Headers {
+		if h.Key != key {
+			headers = append(headers, h)
+		}
+	}
+	c.msg.Headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+// InjectHeaders writes the current trace context (traceparent) and baggage of ctx into
+// the message headers, so the consumer can link its trace to the producing span.
+func InjectHeaders(ctx context.Context, msg *kafka.Message) {
+	flowtracker.Inject(ctx, headersCarrier{msg: msg})
+}
+
+// Produce sends msg inside a "Kafka: Produce <topic>" producer span, whose context is
+// written into the message headers. deliveryChan is passed on to kafka.Producer.Produce.
+func Produce(ctx context.Context, p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	topic := ""
+	if msg.TopicPartition.Topic != nil {
+		topic = *msg.TopicPartition.Topic
+	}
+	ctx, finish := flowtracker.StartSpan(ctx, "Kafka: Produce "+topic, flowtracker.WithSpanKind(flowtracker.SpanKindProducer))
+	defer finish()
+	flowtracker.AddTag(ctx, "messaging.system", "kafka")
+	flowtracker.AddTag(ctx, "messaging.destination.name", topic)
+
+	InjectHeaders(ctx, msg)
+	err := p.Produce(msg, deliveryChan)
+	if err != nil {
+		flowtracker.AddTag(ctx, "error", "true")
+		flowtracker.AddTag(ctx, "error.message", err.Error())
+	}
+	return err
+}
+
+// StartConsumerTrace starts a trace for processing msg through tracer.StartTrace.
+// The root span "Kafka: Consume <topic>" is linked to the producer span found in the
+// message headers, and the baggage sent by the producer is restored into the context.
+// The returned function ends the trace and exports it.
+func StartConsumerTrace(ctx context.Context, tracer *flowtracker.Tracer, msg *kafka.Message) (context.Context, func()) {
+	remote := flowtracker.Extract(context.Background(), headersCarrier{msg: msg})
+	for k, v := range flowtracker.Baggage(remote) {
+		ctx = flowtracker.SetBaggage(ctx, k, v)
+	}
+
+	topic := ""
+	if msg.TopicPartition.Topic != nil {
+		topic = *msg.TopicPartition.Topic
+	}
+	ctx, end := tracer.StartTrace(ctx, "Kafka: Consume "+topic,
+		flowtracker.WithSpanKind(flowtracker.SpanKindConsumer),
+		flowtracker.WithLinks(flowtracker.SpanContextFromContext(remote)),
+	)
+	flowtracker.AddTag(ctx, "messaging.system", "kafka")
+	flowtracker.AddTag(ctx, "messaging.destination.name", topic)
+	flowtracker.AddTagInt(ctx, "messaging.kafka.partition", int64(msg.TopicPartition.Partition))
+	flowtracker.AddTagInt(ctx, "messaging.kafka.offset", int64(msg.TopicPartition.Offset))
+	return ctx, end
+}
@@ -0,0 +1,140 @@
+package confluent_kafka
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/spdeepak/flowtracker"
+)
+
+// chanExporter hands every exported trace to the test through a channel.
+type chanExporter chan *flowtracker.Trace
+
+func (c chanExporter) Export(tr *flowtracker.Trace) {
+	c <- tr
+}
+
+func (c chanExporter) next(t *testing.T) *flowtracker.Trace {
+	t.Helper()
+	select {
+	case tr := <-c:
+		return tr
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for exported trace")
+		return nil
+	}
+}
+
+// newMockCluster starts an in-process Kafka cluster, closed when the test ends.
+func newMockCluster(t *testing.T) *kafka.MockCluster {
+	t.Helper()
+	mc, err := kafka.NewMockCluster(1)
+	if err != nil {
+		t.Fatalf("failed to start mock cluster: %v", err)
+	}
+	t.Cleanup(mc.Close)
+	return mc
+}
+
+func TestProduceAndConsume_LinksTraces(t *testing.T) {
+	mc := newMockCluster(t)
+	topic := "orders"
+
+	p, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": mc.BootstrapServers()})
+	if err != nil {
+		t.Fatalf("failed to create producer: %v", err)
+	}
+	defer p.Close()
+
+	producerExp := make(chanExporter, 1)
+	producerTracer := flowtracker.NewTracer(flowtracker.WithExporter(producerExp))
+	ctx, end := producerTracer.StartTrace(context.Background(), "POST /orders")
+	ctx = flowtracker.SetBaggage(ctx, "tenant", "acme")
+
+	delivery := make(chan kafka.Event, 1)
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Value:          []byte(`{"id":7}`),
+		Headers:        []kafka.Header{{Key: "traceparent", Value: []byte("stale")}},
+	}
+	if err := Produce(ctx, p, msg, delivery); err != nil {
+		t.Fatalf("produce failed: %v", err)
+	}
+	delivered := (<-delivery).(*kafka.Message)
+	if delivered.TopicPartition.Error != nil {
+		t.Fatalf("delivery failed: %v", delivered.TopicPartition.Error)
+	}
+	end()
+	produced := producerExp.next(t)
+
+	produceSpan := produced.Spans[1]
+	if produceSpan.Name != "Kafka: Produce orders" || produceSpan.Kind != flowtracker.SpanKindProducer {
+		t.Errorf("unexpected producer span: %+v", produceSpan)
+	}
+	var traceparents int
+	for _, h := range msg.Headers {
+		if h.Key == flowtracker.TraceParentHeader {
+			traceparents++
+		}
+	}
+	if traceparents != 1 {
+		t.Errorf("expected the traceparent header to be replaced, got %v", msg.Headers)
+	}
+
+	c, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers": mc.BootstrapServers(),
+		"group.id":          "flowtracker-test",
+		"auto.offset.reset": "earliest",
+	})
+	if err != nil {
+		t.Fatalf("failed to create consumer: %v", err)
+	}
+	defer c.Close()
+	if err := c.Subscribe(topic, nil); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	received, err := c.ReadMessage(10 * time.Second)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	consumerExp := make(chanExporter, 1)
+	consumerTracer := flowtracker.NewTracer(flowtracker.WithExporter(consumerExp), flowtracker.WithBaggageTags("baggage."))
+	_, end = StartConsumerTrace(context.Background(), consumerTracer, received)
+	end()
+	consumed := consumerExp.next(t)
+
+	root := consumed.Spans[0]
+	if consumed.TraceID == produced.TraceID || consumed.RemoteParentID != "" {
+		t.Errorf("consumer must start its own trace, got %s (remote parent %q)", consumed.TraceID, consumed.RemoteParentID)
+	}
+	if root.Name != "Kafka: Consume orders" || root.Kind != flowtracker.SpanKindConsumer {
+		t.Errorf("unexpected consumer span: %+v", root)
+	}
+	want := flowtracker.SpanContext{TraceID: produced.TraceID, SpanID: produceSpan.ID}
+	if len(root.Links) != 1 || root.Links[0] != want {
+		t.Errorf("expected a link to %+v, got %+v", want, root.Links)
+	}
+	if root.Tags["messaging.system"] != "kafka" || root.Tags["messaging.kafka.partition"] != strconv.Itoa(int(delivered.TopicPartition.Partition)) ||
+		root.Tags["messaging.kafka.offset"] != "0" {
+		t.Errorf("unexpected messaging tags: %v", root.Tags)
+	}
+	if root.Tags["baggage.tenant"] != "acme" {
+		t.Errorf("expected the producer's baggage, got %v", root.Tags)
+	}
+}
+
+func TestStartConsumerTrace_WithoutHeaders(t *testing.T) {
+	topic := "orders"
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp))
+
+	_, end := StartConsumerTrace(context.Background(), tracer, &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}})
+	end()
+	if tr := exp.next(t); len(tr.Root.Links) != 0 {
+		t.Errorf("expected no links, got %+v", tr.Root.Links)
+	}
+}
@@ -0,0 +1,18 @@
+module github.com/spdeepak/flowtracker/franz-go
+
+go 1.24.0
+
+require (
+	github.com/spdeepak/flowtracker v0.0.3
+	github.com/twmb/franz-go v1.20.7
+	github.com/twmb/franz-go/pkg/kfake v0.0.0-20251021232020-dd73f6664175
+)
+
+require (
+	github.com/klauspost/compress v1.18.4 // indirect
+	github.com/pierrec/lz4/v4 v4.1.25 // indirect
+	github.com/twmb/franz-go/pkg/kmsg v1.12.0 // indirect
+	golang.org/x/crypto v0.48.0 // indirect
+)
+
+replace github.com/spdeepak/flowtracker => ../../
@@ -0,0 +1,211 @@
+package franz_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+	"github.com/spdeepak/flowtracker/exporters"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Config holds the setup parameters.
+// You must provide EITHER Client OR SeedBrokers.
+type Config struct {
+	// Topic is the destination Kafka topic name (Required).
+	Topic string
+
+	// Client allows you to pass an existing franz-go client.
+	// If this is set, SeedBrokers and ClientOptions are ignored.
+	Client *kgo.Client
+
+	// SeedBrokers configures a new client.
+	// Use this if you don't have an existing client.
+	// Example: []string{"localhost:9092"}
+	SeedBrokers []string
+
+	// ClientOptions are passed on to the new client created from SeedBrokers,
+	// e.g. kgo.RequiredAcks(kgo.AllISRAcks()) or SASL settings.
+	ClientOptions []kgo.Opt
+
+	// KeyAttribute names a trace attribute (see flowtracker.SetTraceAttr) used as the record key,
+	// e.g. "tenant" to keep all traces of a tenant on the same partition.
+	// Falls back to the TraceID when empty or when the trace doesn't carry the attribute.
+	KeyAttribute string
+
+	// HeaderAttributes lists trace attributes copied into the record headers,
+	// so consumers can filter without decoding the payload.
+	HeaderAttributes []string
+
+	// OnDelivery is called with the outcome of every record, err is nil on success.
+	OnDelivery func(r *kgo.Record, err error)
+
+	// OnError is called for every trace or record that could not be sent.
+	// Default: log.Printf
+	OnError func(err error)
+
+	// MaxMessageBytes limits the size of a record value. Default: exporters.DefaultMaxMessageBytes
+	MaxMessageBytes int
+
+	// Oversize is applied to traces whose payload exceeds MaxMessageBytes. Default: exporters.OversizeDrop
+	Oversize exporters.OversizeStrategy
+
+	// SpanPerMessage sends one exporters.SpanMessage per span instead of one record per trace.
+	// All spans of a trace share the same key. A span that doesn't fit MaxMessageBytes is dropped.
+	SpanPerMessage bool
+}
+
+// ErrClosed is reported through OnError for traces exported after Close.
+var ErrClosed = errors.New("kafka exporter: closed")
+
+// KafkaExporter implements the flowtracker.Exporter interface.
+type KafkaExporter struct {
+	client *kgo.Client
+	topic  string
+	// encoder builds the records of a trace, shared with the other message broker exporters
+	encoder *exporters.MessageEncoder
+	// isOwned tracks if this exporter created the client (and thus should close it).
+	isOwned bool
+
+	onDelivery func(*kgo.Record, error)
+	onError    func(error)
+	// pending counts the produced records whose promise hasn't run yet
+	pending atomic.Int64
+	// mu guards closed, so no record is produced once Close has started
+	mu        sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+}
+
+// New creates a new KafkaExporter.
+func New(cfg Config) (*KafkaExporter, error) {
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("kafka exporter: topic is required")
+	}
+
+	k := &KafkaExporter{
+		topic: cfg.Topic,
+		encoder: &exporters.MessageEncoder{
+			KeyAttribute:     cfg.KeyAttribute,
+			HeaderAttributes: cfg.HeaderAttributes,
+			MaxMessageBytes:  cfg.MaxMessageBytes,
+			Oversize:         cfg.Oversize,
+			SpanPerMessage:   cfg.SpanPerMessage,
+		},
+		onDelivery: cfg.OnDelivery,
+		onError:    cfg.OnError,
+	}
+	if k.onError == nil {
+		k.onError = func(err error) {
+			log.Printf("FlowTracker Kafka Error: %v\n", err)
+		}
+	}
+
+	if cfg.Client != nil {
+		// Use the user-provided client
+		k.client = cfg.Client
+	} else if len(cfg.SeedBrokers) > 0 {
+		// Initialize a new client
+		opts := append([]kgo.Opt{kgo.SeedBrokers(cfg.SeedBrokers...)}, cfg.ClientOptions...)
+		c, err := kgo.NewClient(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("kafka exporter: failed to create client: %w", err)
+		}
+		k.client = c
+		k.isOwned = true
+	} else {
+		return nil, fmt.Errorf("kafka exporter: must provide either Client or SeedBrokers")
+	}
+
+	return k, nil
+}
+
+// Dropped returns the number of traces, or single spans in SpanPerMessage and OversizeSplit mode,
+// dropped because they exceeded MaxMessageBytes.
+func (k *KafkaExporter) Dropped() uint64 {
+	return k.encoder.Dropped()
+}
+
+// Export sends the trace to Kafka. Traces exported after Close are dropped
+// and reported to OnError with ErrClosed.
+func (k *KafkaExporter) Export(tr *flowtracker.Trace) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.closed {
+		if tr != nil {
+			k.onError(fmt.Errorf("%w: dropped trace %s", ErrClosed, tr.TraceID))
+		}
+		return
+	}
+
+	msgs, err := k.encoder.Encode(tr)
+	if err != nil {
+		k.onError(fmt.Errorf("kafka exporter: %w", err))
+	}
+	for _, m := range msgs {
+		k.produce(m)
+	}
+}
+
+// produce sends an encoded message to the topic.
+func (k *KafkaExporter) produce(m exporters.Message) {
+	// Construct the Kafka Record
+	r := &kgo.Record{
+		Topic:   k.topic,
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: make([]kgo.RecordHeader, len(m.Headers)),
+	}
+	for i, h := range m.Headers {
+		r.Headers[i] = kgo.RecordHeader{Key: h.Key, Value: h.Value}
+	}
+
+	// Produce is asynchronous, the promise runs once the record is delivered or failed.
+	k.pending.Add(1)
+	k.client.Produce(context.Background(), r, func(r *kgo.Record, err error) {
+		defer k.pending.Add(-1)
+		if err != nil {
+			k.onError(fmt.Errorf("kafka exporter: failed to produce record: %w", err))
+		}
+		if k.onDelivery != nil {
+			k.onDelivery(r, err)
+		}
+	})
+}
+
+// Close flushes and closes the client if we own it. A shared client is left open,
+// Close only waits up to 5 seconds for the records of this exporter to be delivered.
+// Calling Close more than once is safe.
+// Note: The main flowtracker library doesn't call Close(), but you can call this
+// manually in your main.go shutdown hook.
+func (k *KafkaExporter) Close() {
+	k.closeOnce.Do(func() {
+		// Wait for the running exports, later ones are dropped
+		k.mu.Lock()
+		k.closed = true
+		k.mu.Unlock()
+
+		if k.isOwned {
+			// Wait up to 5 seconds for outstanding records to be delivered
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := k.client.Flush(ctx); err != nil {
+				k.onError(fmt.Errorf("kafka exporter: flush failed: %w", err))
+			}
+			k.client.Close()
+			return
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for k.pending.Load() > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := k.pending.Load(); n > 0 {
+			k.onError(fmt.Errorf("kafka exporter: %d records still in flight after Close", n))
+		}
+	})
+}
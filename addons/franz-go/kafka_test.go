@@ -0,0 +1,212 @@
+package franz_go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+	"github.com/spdeepak/flowtracker/exporters"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// newCluster starts an in-process Kafka cluster with a "traces" topic, closed when the test ends.
+func newCluster(t *testing.T) *kfake.Cluster {
+	t.Helper()
+	c, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "traces"))
+	if err != nil {
+		t.Fatalf("failed to start fake cluster: %v", err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// newTestExporter creates an exporter producing to a fake cluster and returns
+// a channel receiving its delivered records.
+func newTestExporter(t *testing.T, cfg Config) (*KafkaExporter, chan *kgo.Record, *kfake.Cluster) {
+	t.Helper()
+	c := newCluster(t)
+	delivered := make(chan *kgo.Record, 100)
+	cfg.Topic = "traces"
+	cfg.SeedBrokers = c.ListenAddrs()
+	cfg.OnDelivery = func(r *kgo.Record, err error) {
+		if err != nil {
+			t.Errorf("delivery failed: %v", err)
+		}
+		delivered <- r
+	}
+	exp, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+	t.Cleanup(exp.Close)
+	return exp, delivered, c
+}
+
+// nextDelivery waits for the next delivered record.
+func nextDelivery(t *testing.T, delivered chan *kgo.Record) *kgo.Record {
+	t.Helper()
+	select {
+	case r := <-delivered:
+		return r
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for delivery")
+		return nil
+	}
+}
+
+func header(r *kgo.Record, key string) string {
+	for _, h := range r.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// checkoutTrace is a trace of the "checkout" service with a child span carrying a tag of tagSize bytes.
+func checkoutTrace(tagSize int) *flowtracker.Trace {
+	root := &flowtracker.Span{ID: "00f067aa0ba902b7", Name: "GET /checkout"}
+	return &flowtracker.Trace{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		Root:    root,
+		Spans: []*flowtracker.Span{root, {
+			ID: "53995c3f42cd8ad8", ParentID: root.ID, Name: "step",
+			Tags: map[string]string{"payload": strings.Repeat("x", tagSize)},
+		}},
+		Attributes: map[string]string{"tenant": "acme"},
+		Resource:   &flowtracker.Resource{ServiceName: "checkout"},
+	}
+}
+
+func TestExport_HeadersAndConsume(t *testing.T) {
+	exp, delivered, cluster := newTestExporter(t, Config{HeaderAttributes: []string{"tenant"}})
+	tr := checkoutTrace(10)
+	exp.Export(tr)
+	nextDelivery(t, delivered)
+
+	consumer, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics("traces"))
+	if err != nil {
+		t.Fatalf("failed to create consumer: %v", err)
+	}
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	fetches := consumer.PollRecords(ctx, 1)
+	if errs := fetches.Errors(); len(errs) > 0 {
+		t.Fatalf("fetch failed: %v", errs)
+	}
+	r := fetches.Records()[0]
+
+	if string(r.Key) != tr.TraceID {
+		t.Errorf("expected the trace ID as key, got %s", r.Key)
+	}
+	want := map[string]string{
+		exporters.HeaderServiceName:   "checkout",
+		exporters.HeaderSchemaVersion: exporters.SchemaVersion,
+		exporters.HeaderContentType:   exporters.ContentTypeTrace,
+		"tenant":                      "acme",
+	}
+	for k, v := range want {
+		if got := header(r, k); got != v {
+			t.Errorf("expected header %s=%q, got %q", k, v, got)
+		}
+	}
+	var got flowtracker.Trace
+	if err := json.Unmarshal(r.Value, &got); err != nil || got.TraceID != tr.TraceID || len(got.Spans) != 2 {
+		t.Errorf("unexpected payload %s (err %v)", r.Value, err)
+	}
+}
+
+func TestNew_ExistingClient(t *testing.T) {
+	cluster := newCluster(t)
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	delivered := make(chan *kgo.Record, 1)
+	exp, err := New(Config{Topic: "traces", Client: client, KeyAttribute: "tenant",
+		OnDelivery: func(r *kgo.Record, err error) { delivered <- r }})
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+	exp.Export(checkoutTrace(10))
+	// Close must not close a client it doesn't own, but waits for the records of the exporter
+	exp.Close()
+	exp.Close()
+	select {
+	case <-delivered:
+	default:
+		t.Error("expected the record to be delivered before Close returned")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r, err := client.ProduceSync(ctx, &kgo.Record{Topic: "traces", Value: []byte("still open")}).First()
+	if err != nil || r.Offset != 1 {
+		t.Errorf("expected the client to stay usable after the trace at offset 0, got %+v (err %v)", r, err)
+	}
+}
+
+func TestClose_Twice(t *testing.T) {
+	exp, delivered, _ := newTestExporter(t, Config{})
+	exp.Export(checkoutTrace(10))
+	exp.Close()
+	exp.Close()
+	select {
+	case <-delivered:
+	default:
+		t.Error("expected the record to be flushed by Close")
+	}
+}
+
+func TestExport_AfterClose(t *testing.T) {
+	errs := make(chan error, 1)
+	exp, _, _ := newTestExporter(t, Config{OnError: func(err error) { errs <- err }})
+	exp.Close()
+	exp.Export(checkoutTrace(10))
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	default:
+		t.Fatal("expected the dropped trace to be reported")
+	}
+}
+
+func TestNew_RequiresClientOrBrokers(t *testing.T) {
+	if _, err := New(Config{Topic: "traces"}); err == nil {
+		t.Error("expected an error without Client and SeedBrokers")
+	}
+	if _, err := New(Config{SeedBrokers: []string{"localhost:9092"}}); err == nil {
+		t.Error("expected an error without Topic")
+	}
+}
+
+func TestExport_OversizeDrop(t *testing.T) {
+	errs := make(chan error, 1)
+	exp, delivered, _ := newTestExporter(t, Config{
+		MaxMessageBytes: 1000,
+		OnError:         func(err error) { errs <- err },
+	})
+	exp.Export(checkoutTrace(2000))
+
+	if err := <-errs; !errors.Is(err, exporters.ErrMessageTooLarge) {
+		t.Errorf("expected exporters.ErrMessageTooLarge, got %v", err)
+	}
+	if exp.Dropped() != 1 {
+		t.Errorf("expected 1 dropped trace, got %d", exp.Dropped())
+	}
+
+	// Traces that fit are still sent
+	exp.Export(checkoutTrace(10))
+	nextDelivery(t, delivered)
+}
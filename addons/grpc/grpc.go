@@ -0,0 +1,201 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/spdeepak/flowtracker"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// metadataCarrier adapts gRPC metadata to the flowtracker.Carrier interface.
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	return strings.Join(metadata.MD(m).Get(key), ",")
+}
+
+func (m metadataCarrier) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+// ---------------------------------------------------------
+// Server Interceptors
+// ---------------------------------------------------------
+
+// UnaryServerInterceptor starts a trace for every unary call, named after the full method
+// (e.g. "/helloworld.Greeter/SayHello"). It continues the caller's trace if the
+// incoming metadata carries a traceparent.
+func UnaryServerInterceptor(tracer *flowtracker.Tracer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, end := startServerTrace(ctx, tracer, info.FullMethod)
+		defer end()
+
+		resp, err := handler(ctx, req)
+		setStatus(ctx, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor starts a trace for every streaming call, which ends when the handler returns.
+func StreamServerInterceptor(tracer *flowtracker.Tracer) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, end := startServerTrace(ss.Context(), tracer, info.FullMethod)
+		defer end()
+
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		setStatus(ctx, err)
+		return err
+	}
+}
+
+func startServerTrace(ctx context.Context, tracer *flowtracker.Tracer, method string) (context.Context, func()) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = flowtracker.Extract(ctx, metadataCarrier(md))
+	}
+	ctx, end := tracer.StartTrace(ctx, method, flowtracker.WithSpanKind(flowtracker.SpanKindServer))
+	addMethodTags(ctx, method)
+	return ctx, end
+}
+
+// serverStream swaps the stream's context for the one carrying the trace.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// ---------------------------------------------------------
+// Client Interceptors
+// ---------------------------------------------------------
+
+// UnaryClientInterceptor creates a client span for every unary call made inside a trace
+// and sends the trace context to the server in the outgoing metadata.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, finish := startClientSpan(ctx, method)
+		defer finish()
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		setStatus(ctx, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor creates a client span for every streaming call made inside a trace.
+// The span ends when the stream is done: the response of a client-streaming call was received,
+// the server closed the stream, it failed, or its context was cancelled.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, finish := startClientSpan(ctx, method)
+
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			setStatus(ctx, err)
+			finish()
+			return nil, err
+		}
+		s := &clientStream{ClientStream: cs, ctx: ctx, desc: desc, finish: finish, done: make(chan struct{})}
+		go s.watch()
+		return s, nil
+	}
+}
+
+func startClientSpan(ctx context.Context, method string) (context.Context, func()) {
+	ctx, finish := flowtracker.StartSpan(ctx, method, flowtracker.WithSpanKind(flowtracker.SpanKindClient))
+	addMethodTags(ctx, method)
+
+	// Copy the metadata, the one stored in ctx must not be modified
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	flowtracker.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), finish
+}
+
+// clientStream ends the client span once the stream has finished.
+type clientStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	desc   *grpc.StreamDesc
+	finish func()
+	once   sync.Once
+	done   chan struct{}
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == io.EOF {
+		s.end(nil)
+	} else if err != nil {
+		s.end(err)
+	} else if !s.desc.ServerStreams {
+		// The single response of a unary or client-streaming call ends it
+		s.end(nil)
+	}
+	return err
+}
+
+func (s *clientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err != nil {
+		s.end(err)
+	}
+	return md, err
+}
+
+// watch ends the span when the stream's context is done, as a caller that cancels a
+// stream does not have to receive from it again. If the trace ended first, the core
+// ignores the late tags and end, so the exported span isn't modified.
+func (s *clientStream) watch() {
+	select {
+	case <-s.ctx.Done():
+		s.end(status.FromContextError(s.ctx.Err()).Err())
+	case <-s.done:
+	}
+}
+
+func (s *clientStream) end(err error) {
+	s.once.Do(func() {
+		setStatus(s.ctx, err)
+		s.finish()
+		close(s.done)
+	})
+}
+
+// ---------------------------------------------------------
+// Tags
+// ---------------------------------------------------------
+
+// addMethodTags splits "/package.Service/Method" into rpc.service and rpc.method tags.
+func addMethodTags(ctx context.Context, fullMethod string) {
+	flowtracker.AddTag(ctx, "rpc.system", "grpc")
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if ok {
+		flowtracker.AddTag(ctx, "rpc.service", service)
+		flowtracker.AddTag(ctx, "rpc.method", method)
+	}
+}
+
+// setStatus records the gRPC status code, and flags the span as failed for non-OK codes.
+func setStatus(ctx context.Context, err error) {
+	st := status.Convert(err)
+	flowtracker.AddTagInt(ctx, "rpc.grpc.status_code", int64(st.Code()))
+	flowtracker.AddTag(ctx, "rpc.grpc.status", st.Code().String())
+	if st.Code() != codes.OK {
+		flowtracker.AddTag(ctx, "error", "true")
+		flowtracker.AddTag(ctx, "error.message", st.Message())
+	}
+}
@@ -0,0 +1,315 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// chanExporter hands every exported trace to the test through a channel.
+type chanExporter chan *flowtracker.Trace
+
+func (c chanExporter) Export(tr *flowtracker.Trace) {
+	c <- tr
+}
+
+func (c chanExporter) next(t *testing.T) *flowtracker.Trace {
+	t.Helper()
+	select {
+	case tr := <-c:
+		return tr
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for exported trace")
+		return nil
+	}
+}
+
+// endedSpans hands every ended span to the test through a channel.
+type endedSpans chan *flowtracker.Span
+
+func (c endedSpans) OnStart(context.Context, *flowtracker.Span) {}
+
+func (c endedSpans) OnEnd(span *flowtracker.Span) {
+	c <- span
+}
+
+func (c endedSpans) next(t *testing.T, name string) *flowtracker.Span {
+	t.Helper()
+	for {
+		select {
+		case span := <-c:
+			if span.Name == name {
+				return span
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for span %q to end", name)
+			return nil
+		}
+	}
+}
+
+// collectDesc is a client-streaming service counting the requests it receives.
+var collectDesc = grpc.ServiceDesc{
+	ServiceName: "test.Collector",
+	HandlerType: (*any)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Collect",
+		ClientStreams: true,
+		Handler: func(_ any, ss grpc.ServerStream) error {
+			for {
+				var req healthpb.HealthCheckRequest
+				if err := ss.RecvMsg(&req); err == io.EOF {
+					return ss.SendMsg(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+				} else if err != nil {
+					return err
+				}
+			}
+		},
+	}},
+}
+
+// newTestClient starts a health server behind the FlowTracker server interceptors on an
+// in-memory listener, and returns a client using the FlowTracker client interceptors.
+func newTestClient(t *testing.T, serverExp chanExporter) healthpb.HealthClient {
+	t.Helper()
+	return healthpb.NewHealthClient(newTestConn(t, serverExp))
+}
+
+// newTestConn is newTestClient returning the connection, which also serves collectDesc.
+func newTestConn(t *testing.T, serverExp chanExporter) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(serverExp), flowtracker.WithBaggageTags("baggage."))
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(tracer)),
+		grpc.StreamInterceptor(StreamServerInterceptor(tracer)),
+	)
+	hs := health.NewServer()
+	hs.SetServingStatus("orders", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	srv.RegisterService(&collectDesc, struct{}{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(StreamClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestUnary_EndToEnd(t *testing.T) {
+	serverExp, clientExp := make(chanExporter, 10), make(chanExporter, 10)
+	client := newTestClient(t, serverExp)
+
+	clientTracer := flowtracker.NewTracer(flowtracker.WithExporter(clientExp))
+	ctx, end := clientTracer.StartTrace(context.Background(), "GET /status")
+	ctx = flowtracker.SetBaggage(ctx, "tenant", "acme")
+
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "orders"}); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+	end()
+
+	clientTrace := clientExp.next(t)
+	if len(clientTrace.Spans) != 3 {
+		t.Fatalf("expected root + 2 client spans, got %d", len(clientTrace.Spans))
+	}
+	okSpan, failedSpan := clientTrace.Spans[1], clientTrace.Spans[2]
+	if okSpan.Name != "/grpc.health.v1.Health/Check" || okSpan.Kind != flowtracker.SpanKindClient {
+		t.Errorf("unexpected client span: %+v", okSpan)
+	}
+	if okSpan.Tags["rpc.service"] != "grpc.health.v1.Health" || okSpan.Tags["rpc.method"] != "Check" {
+		t.Errorf("unexpected method tags: %v", okSpan.Tags)
+	}
+	if okSpan.Tags["rpc.grpc.status_code"] != "0" || okSpan.Tags["error"] != "" {
+		t.Errorf("unexpected status tags on successful call: %v", okSpan.Tags)
+	}
+	if failedSpan.Tags["rpc.grpc.status_code"] != "5" || failedSpan.Tags["error"] != "true" {
+		t.Errorf("unexpected status tags on failed call: %v", failedSpan.Tags)
+	}
+
+	// Both server traces continue the client trace, each under its own client span
+	for _, clientSpan := range []*flowtracker.Span{okSpan, failedSpan} {
+		tr := serverExp.next(t)
+		if tr.TraceID != clientTrace.TraceID || tr.RemoteParentID != clientSpan.ID {
+			t.Errorf("server trace %s/%s is not linked to client span %s/%s",
+				tr.TraceID, tr.RemoteParentID, clientTrace.TraceID, clientSpan.ID)
+		}
+		if tr.Root.Name != "/grpc.health.v1.Health/Check" || tr.Root.Kind != flowtracker.SpanKindServer {
+			t.Errorf("unexpected server root span: %+v", tr.Root)
+		}
+		if tr.Root.Tags["baggage.tenant"] != "acme" {
+			t.Errorf("expected baggage to reach the server, got %v", tr.Root.Tags)
+		}
+		if tr.Root.Tags["rpc.grpc.status_code"] != clientSpan.Tags["rpc.grpc.status_code"] {
+			t.Errorf("server and client disagree on status: %v vs %v", tr.Root.Tags, clientSpan.Tags)
+		}
+	}
+}
+
+func TestStream_EndToEnd(t *testing.T) {
+	serverExp, clientExp := make(chanExporter, 10), make(chanExporter, 10)
+	client := newTestClient(t, serverExp)
+
+	clientTracer := flowtracker.NewTracer(flowtracker.WithExporter(clientExp))
+	ctx, end := clientTracer.StartTrace(context.Background(), "watch")
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream, err := client.Watch(streamCtx, &healthpb.HealthCheckRequest{Service: "orders"})
+	if err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("unexpected watch response: %v, %v", resp, err)
+	}
+	cancel()
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Fatalf("expected Canceled, got %v", err)
+	}
+	end()
+
+	clientTrace := clientExp.next(t)
+	if len(clientTrace.Spans) != 2 {
+		t.Fatalf("expected root + 1 client span, got %d", len(clientTrace.Spans))
+	}
+	clientSpan := clientTrace.Spans[1]
+	if clientSpan.Name != "/grpc.health.v1.Health/Watch" || clientSpan.EndTime.IsZero() {
+		t.Errorf("expected finished Watch client span, got %+v", clientSpan)
+	}
+	if clientSpan.Tags["rpc.grpc.status"] != "Canceled" {
+		t.Errorf("unexpected status tags: %v", clientSpan.Tags)
+	}
+
+	tr := serverExp.next(t)
+	if tr.TraceID != clientTrace.TraceID || tr.RemoteParentID != clientSpan.ID {
+		t.Errorf("server trace is not linked to the client span")
+	}
+	if tr.Root.Name != "/grpc.health.v1.Health/Watch" {
+		t.Errorf("unexpected server root span: %q", tr.Root.Name)
+	}
+}
+
+func TestStream_ClientStreaming(t *testing.T) {
+	serverExp, clientExp, ended := make(chanExporter, 10), make(chanExporter, 10), make(endedSpans, 10)
+	conn := newTestConn(t, serverExp)
+
+	clientTracer := flowtracker.NewTracer(flowtracker.WithExporter(clientExp), flowtracker.WithSpanProcessor(ended))
+	ctx, end := clientTracer.StartTrace(context.Background(), "collect")
+
+	stream, err := conn.NewStream(ctx, &collectDesc.Streams[0], "/test.Collector/Collect")
+	if err != nil {
+		t.Fatalf("collect failed: %v", err)
+	}
+	for range 3 {
+		if err := stream.SendMsg(&healthpb.HealthCheckRequest{Service: "orders"}); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("close send failed: %v", err)
+	}
+	var resp healthpb.HealthCheckResponse
+	if err := stream.RecvMsg(&resp); err != nil {
+		t.Fatalf("recv failed: %v", err)
+	}
+
+	// Receiving the response ends the span, without another RecvMsg returning io.EOF
+	span := ended.next(t, "/test.Collector/Collect")
+	end()
+	if span.Tags["rpc.grpc.status"] != "OK" {
+		t.Errorf("unexpected status tags: %v", span.Tags)
+	}
+	if tr := clientExp.next(t); len(tr.Spans) != 2 || tr.Spans[1].EndTime.IsZero() {
+		t.Errorf("expected root + 1 finished client span, got %+v", tr.Spans)
+	}
+	if tr := serverExp.next(t); tr.Root.Name != "/test.Collector/Collect" {
+		t.Errorf("unexpected server root span: %q", tr.Root.Name)
+	}
+}
+
+func TestStream_Cancelled(t *testing.T) {
+	serverExp, ended := make(chanExporter, 10), make(endedSpans, 10)
+	client := newTestClient(t, serverExp)
+
+	clientTracer := flowtracker.NewTracer(flowtracker.WithSpanProcessor(ended))
+	ctx, end := clientTracer.StartTrace(context.Background(), "watch")
+	defer end()
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream, err := client.Watch(streamCtx, &healthpb.HealthCheckRequest{Service: "orders"})
+	if err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("unexpected watch error: %v", err)
+	}
+
+	// The caller gives up on the stream without receiving from it again
+	cancel()
+	span := ended.next(t, "/grpc.health.v1.Health/Watch")
+	if span.EndTime.IsZero() || span.Tags["rpc.grpc.status"] != "Canceled" || span.Tags["error"] != "true" {
+		t.Errorf("expected a cancelled span, got %+v", span)
+	}
+}
+
+func TestStream_CancelledAfterTraceEnded(t *testing.T) {
+	serverExp, clientExp, ended := make(chanExporter, 10), make(chanExporter, 1), make(endedSpans, 10)
+	client := newTestClient(t, serverExp)
+
+	clientTracer := flowtracker.NewTracer(flowtracker.WithExporter(clientExp), flowtracker.WithSpanProcessor(ended))
+	ctx, end := clientTracer.StartTrace(context.Background(), "watch")
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Watch(streamCtx, &healthpb.HealthCheckRequest{Service: "orders"})
+	if err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("unexpected watch error: %v", err)
+	}
+
+	// The trace is exported while the stream is still open
+	end()
+	ended.next(t, "watch")
+	tr := clientExp.next(t)
+
+	// Cancelling it afterwards must not change the exported span
+	cancel()
+	select {
+	case span := <-ended:
+		t.Errorf("span %q ended after its trace was exported", span.Name)
+	case <-time.After(200 * time.Millisecond):
+	}
+	for _, span := range tr.Spans {
+		if span.Tags["rpc.grpc.status"] != "" {
+			t.Errorf("span %q tagged after its trace was exported: %v", span.Name, span.Tags)
+		}
+	}
+}
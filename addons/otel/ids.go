@@ -0,0 +1,64 @@
+package otel
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// idsKey carries the IDs the OTel span started with the context should get.
+type idsKey struct{}
+
+type spanIDs struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+// withIDs returns a copy of ctx asking IDGenerator for the given IDs.
+func withIDs(ctx context.Context, traceID trace.TraceID, spanID trace.SpanID) context.Context {
+	return context.WithValue(ctx, idsKey{}, spanIDs{traceID: traceID, spanID: spanID})
+}
+
+// idGenerator hands out the IDs set with withIDs and random IDs for every other span.
+type idGenerator struct{}
+
+// IDGenerator returns an sdktrace.IDGenerator that lets the exporter keep the original
+// FlowTracker trace and span IDs, so they match the IDs in logs and propagated headers.
+// Spans not created by the exporter get random IDs, like with the default generator.
+//
+// Example:
+//
+//	tp := sdktrace.NewTracerProvider(sdktrace.WithIDGenerator(otelexporter.IDGenerator()), ...)
+func IDGenerator() sdktrace.IDGenerator {
+	return idGenerator{}
+}
+
+func (idGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if ids, ok := ctx.Value(idsKey{}).(spanIDs); ok && ids.traceID.IsValid() && ids.spanID.IsValid() {
+		return ids.traceID, ids.spanID
+	}
+	var tid trace.TraceID
+	for !tid.IsValid() {
+		binary.BigEndian.PutUint64(tid[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(tid[8:], rand.Uint64())
+	}
+	return tid, randomSpanID()
+}
+
+func (idGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	if ids, ok := ctx.Value(idsKey{}).(spanIDs); ok && ids.traceID == traceID && ids.spanID.IsValid() {
+		return ids.spanID
+	}
+	return randomSpanID()
+}
+
+func randomSpanID() trace.SpanID {
+	var sid trace.SpanID
+	for !sid.IsValid() {
+		binary.BigEndian.PutUint64(sid[:], rand.Uint64())
+	}
+	return sid
+}
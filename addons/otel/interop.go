@@ -0,0 +1,54 @@
+package otel
+
+import (
+	"context"
+
+	"github.com/spdeepak/flowtracker"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// contextBridge implements flowtracker.ContextBridge for the OTel context.
+type contextBridge struct{}
+
+// WithContextInterop connects FlowTracker to the OTel spans in the context:
+//
+//   - StartTrace and StartSpan adopt an active OTel span as parent, e.g. one started by
+//     otelhttp or the AWS SDK, instead of starting a separate tree.
+//   - Every FlowTracker span becomes the active OTel span, so spans of OTel-instrumented
+//     libraries called with its context nest under it.
+//
+// Example:
+//
+//	mw := flowtracker.NewMiddleware(flowtracker.WithExporter(exp), otelexporter.WithContextInterop())
+//
+// The OTel spans themselves are not part of the FlowTracker trace, add NewSpanProcessor
+// to the TracerProvider for that.
+func WithContextInterop() flowtracker.Option {
+	return flowtracker.WithContextBridge(contextBridge{})
+}
+
+func (contextBridge) SpanContextFromContext(ctx context.Context) (flowtracker.SpanContext, bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return flowtracker.SpanContext{}, false
+	}
+	return flowtracker.SpanContext{TraceID: sc.TraceID().String(), SpanID: sc.SpanID().String()}, true
+}
+
+func (contextBridge) ContextWithSpanContext(ctx context.Context, sc flowtracker.SpanContext) context.Context {
+	tid, err := trace.TraceIDFromHex(sc.TraceID)
+	if err != nil {
+		return ctx
+	}
+	sid, err := trace.SpanIDFromHex(sc.SpanID)
+	if err != nil {
+		return ctx
+	}
+	// FlowTracker records every request, so the span is sampled
+	return trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: trace.FlagsSampled,
+	}))
+}
@@ -0,0 +1,68 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spdeepak/flowtracker"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWithContextInterop(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr), sdktrace.WithIDGenerator(IDGenerator()))
+	lib := tp.Tracer("instrumented-library")
+
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp), WithContextInterop())
+
+	// An OTel server span (e.g. otelhttp) is active when the FlowTracker trace starts
+	ctx, server := lib.Start(context.Background(), "otelhttp")
+	ctx, end := tracer.StartTrace(ctx, "GET /orders")
+
+	// OTel spans started from a FlowTracker span nest under it
+	ctx, finish := flowtracker.StartSpan(ctx, "Load Order")
+	libCtx, call := lib.Start(ctx, "DynamoDB.GetItem")
+
+	// FlowTracker spans started from an OTel span nest under it
+	_, finishInner := flowtracker.StartSpan(libCtx, "Decode Item")
+	finishInner()
+	call.End()
+	finish()
+	end()
+	server.End()
+	tr := exp.next(t)
+
+	serverSC := server.SpanContext()
+	if tr.TraceID != serverSC.TraceID().String() || tr.RemoteParentID != serverSC.SpanID().String() {
+		t.Errorf("expected the trace to continue the OTel span %s/%s, got %s/%s",
+			serverSC.TraceID(), serverSC.SpanID(), tr.TraceID, tr.RemoteParentID)
+	}
+	load, decode := tr.Spans[1], tr.Spans[2]
+	var got sdktrace.ReadOnlySpan
+	for _, s := range sr.Ended() {
+		if s.Name() == "DynamoDB.GetItem" {
+			got = s
+		}
+	}
+	if got.Parent().SpanID().String() != load.ID || got.SpanContext().TraceID().String() != tr.TraceID {
+		t.Errorf("expected the OTel span below %q, got parent %s", load.Name, got.Parent().SpanID())
+	}
+	if decode.ParentID != got.SpanContext().SpanID().String() {
+		t.Errorf("expected %q below the OTel span, got parent %s", decode.Name, decode.ParentID)
+	}
+
+	// Exported through the bridge, the FlowTracker spans join the OTel tree
+	bridged := tracetest.NewSpanRecorder()
+	New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(bridged), sdktrace.WithIDGenerator(IDGenerator()))).Export(tr)
+	parents := map[string]trace.SpanID{}
+	for _, s := range bridged.Ended() {
+		parents[s.Name()] = s.Parent().SpanID()
+	}
+	if parents["GET /orders"] != serverSC.SpanID() || parents["Decode Item"] != got.SpanContext().SpanID() {
+		t.Errorf("unexpected parents after export: %v", parents)
+	}
+}
@@ -18,6 +18,12 @@ type OTelExporter struct {
 
 // New creates a new OTelExporter.
 // You can pass a specific TracerProvider, or nil to use the global global.TracerProvider().
+// Configure the provider with IDGenerator to keep the FlowTracker trace and span IDs.
+//
+// An OTel resource belongs to the TracerProvider, so the exporter cannot apply the
+// trace's Resource. Build the provider with sdktrace.WithResource(NewResource(...)) from
+// the Resource given to flowtracker.WithResource, or the spans are attributed to the
+// provider's default resource.
 func New(tp trace.TracerProvider) *OTelExporter {
 	if tp == nil {
 		tp = otel.GetTracerProvider()
@@ -31,59 +37,158 @@ func (e *OTelExporter) Export(tr *flowtracker.Trace) {
 	if tr.Root == nil {
 		return
 	}
+	traceID, _ := trace.TraceIDFromHex(tr.TraceID)
 
-	// 1. Map FlowTracker Span IDs to the corresponding *flowtracker.Span
-	//    This helps us traverse the tree easily.
-	spanMap := make(map[string]*flowtracker.Span)
+	// 1. Index the children of every span, so the tree is walked in O(N).
+	//    Spans whose parent is not in the trace, such as an OTel span adopted with
+	//    WithContextInterop, are started below that parent as a remote span, or below
+	//    the root if the TracerProvider doesn't keep the IDs (see IDGenerator).
+	known := make(map[string]bool, len(tr.Spans))
 	for _, s := range tr.Spans {
-		spanMap[s.ID] = s
+		known[s.ID] = true
+	}
+	children := make(map[string][]*flowtracker.Span, len(tr.Spans))
+	var detached []*flowtracker.Span
+	for _, s := range tr.Spans {
+		switch {
+		case s == tr.Root:
+		case known[s.ParentID]:
+			children[s.ParentID] = append(children[s.ParentID], s)
+		default:
+			detached = append(detached, s)
+		}
 	}
 
 	// 2. Recursive function to create OTel spans
 	//    We use recursion to ensure the Parent OTel Context is created
 	//    before the Child OTel Span is started.
+	var rootCtx context.Context
 	var createSpan func(node *flowtracker.Span, parentCtx context.Context)
 	createSpan = func(node *flowtracker.Span, parentCtx context.Context) {
 
-		// A. Convert Tags to OTel Attributes
-		var attrs []attribute.KeyValue
+		// A. Convert Tags to typed OTel Attributes
+		attrs := make([]attribute.KeyValue, 0, len(node.Tags)+2)
 		// Add the original FlowTracker IDs as attributes for cross-referencing
 		attrs = append(attrs, attribute.String("flowtracker.trace_id", tr.TraceID))
 		attrs = append(attrs, attribute.String("flowtracker.span_id", node.ID))
+		if node == tr.Root {
+			// Trace attributes describe the whole request, the root span is their closest match
+			attrs = append(attrs, attributes(tr.Attributes, nil)...)
+		}
+		attrs = append(attrs, attributes(node.Tags, node.TagTypes)...)
 
-		if node.Tags != nil {
-			for k, v := range node.Tags {
-				attrs = append(attrs, attribute.String(k, v))
+		var links []trace.Link
+		for _, l := range node.Links {
+			if sc, ok := spanContext(l.TraceID, l.SpanID); ok {
+				links = append(links, trace.Link{SpanContext: sc})
 			}
 		}
 
 		// B. Start the OTel Span "retroactively"
 		//    We use WithTimestamp to tell OTel exactly when this happened in the past.
-		ctx, span := e.tracer.Start(parentCtx, node.Name,
+		//    IDGenerator picks the original IDs up from the context.
+		spanID, _ := trace.SpanIDFromHex(node.ID)
+		ctx, span := e.tracer.Start(withIDs(parentCtx, traceID, spanID), node.Name,
 			trace.WithTimestamp(node.StartTime),
 			trace.WithAttributes(attrs...),
-			// You could map span kinds here if you added that to your library later
-			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithSpanKind(spanKind(node.Kind)),
+			trace.WithLinks(links...),
 		)
 
-		// C. Check for errors (simple convention: if tag "error" exists, mark span as error)
+		if node == tr.Root {
+			rootCtx = ctx
+		}
+
+		// C. Events
+		for _, ev := range node.Events {
+			span.AddEvent(ev.Name, trace.WithTimestamp(ev.Time), trace.WithAttributes(attributes(ev.Attributes, nil)...))
+		}
+
+		// D. Check for errors (convention: the "error" tag marks the span, "error.message" describes it)
 		if val, ok := node.Tags["error"]; ok && val == "true" {
-			span.SetStatus(codes.Error, "Error flagged in FlowTracker")
+			msg := node.Tags["error.message"]
+			if msg == "" {
+				msg = "Error flagged in FlowTracker"
+			}
+			span.SetStatus(codes.Error, msg)
 		}
 
-		// D. End the span "retroactively"
+		// E. End the span "retroactively"
 		span.End(trace.WithTimestamp(node.EndTime))
 
-		// E. Find children and process them
-		//    (Naive search is O(N^2), but N is usually small < 100 per request)
-		for _, s := range tr.Spans {
-			if s.ParentID == node.ID {
-				createSpan(s, ctx) // Pass the NEW OTel context down
-			}
+		// F. Process the children
+		for _, s := range children[node.ID] {
+			createSpan(s, ctx) // Pass the NEW OTel context down
 		}
 	}
 
-	// 3. Kick off with the Root Span
-	//    We use a background context because the root has no parent.
-	createSpan(tr.Root, context.Background())
+	// 3. Kick off with the Root Span.
+	//    A trace continuing a remote caller keeps it as the parent.
+	ctx := context.Background()
+	if sc, ok := spanContext(tr.TraceID, tr.RemoteParentID); ok {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+	}
+	createSpan(tr.Root, ctx)
+
+	keepsIDs := trace.SpanContextFromContext(rootCtx).TraceID() == traceID
+	for _, s := range detached {
+		if sc, ok := spanContext(tr.TraceID, s.ParentID); ok && keepsIDs {
+			createSpan(s, trace.ContextWithRemoteSpanContext(context.Background(), sc))
+		} else {
+			createSpan(s, rootCtx)
+		}
+	}
+}
+
+// spanContext builds a sampled, remote OTel span context from FlowTracker's hex IDs.
+func spanContext(traceID, spanID string) (trace.SpanContext, bool) {
+	tid, err := trace.TraceIDFromHex(traceID)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	sid, err := trace.SpanIDFromHex(spanID)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	return sc, sc.IsValid()
+}
+
+func spanKind(k flowtracker.SpanKind) trace.SpanKind {
+	switch k {
+	case flowtracker.SpanKindServer:
+		return trace.SpanKindServer
+	case flowtracker.SpanKindClient:
+		return trace.SpanKindClient
+	case flowtracker.SpanKindProducer:
+		return trace.SpanKindProducer
+	case flowtracker.SpanKindConsumer:
+		return trace.SpanKindConsumer
+	default:
+		return trace.SpanKindInternal
+	}
+}
+
+// attributes converts tags to OTel attributes. Tags are strings, unless types records
+// the type they were added with (see flowtracker.AddTagInt).
+func attributes(tags map[string]string, types map[string]flowtracker.TagType) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(tags))
+	for k, v := range tags {
+		switch tv := flowtracker.TypedValue(v, types[k]).(type) {
+		case bool:
+			attrs = append(attrs, attribute.Bool(k, tv))
+		case int64:
+			attrs = append(attrs, attribute.Int64(k, tv))
+		case float64:
+			attrs = append(attrs, attribute.Float64(k, tv))
+		default:
+			attrs = append(attrs, attribute.String(k, v))
+		}
+	}
+	return attrs
 }
@@ -0,0 +1,210 @@
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// chanExporter hands every exported trace to the test through a channel.
+type chanExporter chan *flowtracker.Trace
+
+func (c chanExporter) Export(tr *flowtracker.Trace) {
+	c <- tr
+}
+
+func (c chanExporter) next(t *testing.T) *flowtracker.Trace {
+	t.Helper()
+	select {
+	case tr := <-c:
+		return tr
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for exported trace")
+		return nil
+	}
+}
+
+// attr returns the value of key in attrs.
+func attr(attrs []attribute.KeyValue, key attribute.Key) (attribute.Value, bool) {
+	set := attribute.NewSet(attrs...)
+	return set.Value(key)
+}
+
+// recordTrace records a trace continuing a remote caller, with a client span
+// that has an event, a link and an error, and a nested internal span.
+func recordTrace(t *testing.T, remote, link flowtracker.SpanContext) *flowtracker.Trace {
+	t.Helper()
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp))
+
+	ctx := flowtracker.ContextWithRemoteSpanContext(context.Background(), remote)
+	ctx, end := tracer.StartTrace(ctx, "GET /orders", flowtracker.WithSpanKind(flowtracker.SpanKindServer))
+	flowtracker.SetTraceAttr(ctx, "tenant", "acme")
+	flowtracker.AddTagInt(ctx, "http.status_code", 500)
+
+	cctx, finish := flowtracker.StartSpan(ctx, "HTTP: GET inventory", flowtracker.WithSpanKind(flowtracker.SpanKindClient), flowtracker.WithLinks(link))
+	flowtracker.AddEvent(cctx, "retry", map[string]string{"attempt": "2"})
+	flowtracker.AddTag(cctx, "error", "true")
+	flowtracker.AddTag(cctx, "error.message", "connection refused")
+	flowtracker.AddTag(cctx, "order.id", "12345")
+	flowtracker.AddTagFloat(cctx, "ratio", 0.25)
+	flowtracker.AddTagBool(cctx, "cache.hit", false)
+	_, finishInner := flowtracker.StartSpan(cctx, "parse")
+	finishInner()
+	finish()
+	end()
+	return exp.next(t)
+}
+
+func TestExport_FullFidelity(t *testing.T) {
+	remote := flowtracker.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	link := flowtracker.SpanContext{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331"}
+	tr := recordTrace(t, remote, link)
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr), sdktrace.WithIDGenerator(IDGenerator()))
+	New(tp).Export(tr)
+
+	ended := sr.Ended()
+	if len(ended) != len(tr.Spans) {
+		t.Fatalf("expected %d spans, got %d", len(tr.Spans), len(ended))
+	}
+	byName := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range ended {
+		byName[s.Name()] = s
+	}
+
+	for _, s := range tr.Spans {
+		got := byName[s.Name]
+		if got.SpanContext().TraceID().String() != tr.TraceID || got.SpanContext().SpanID().String() != s.ID {
+			t.Errorf("span %q: expected IDs %s/%s, got %s/%s", s.Name, tr.TraceID, s.ID,
+				got.SpanContext().TraceID(), got.SpanContext().SpanID())
+		}
+		wantParent := s.ParentID
+		if s == tr.Root {
+			wantParent = remote.SpanID
+		}
+		if got.Parent().SpanID().String() != wantParent {
+			t.Errorf("span %q: expected parent %s, got %s", s.Name, wantParent, got.Parent().SpanID())
+		}
+		if !got.StartTime().Equal(s.StartTime) || !got.EndTime().Equal(s.EndTime) {
+			t.Errorf("span %q: timestamps not preserved", s.Name)
+		}
+	}
+
+	root := byName["GET /orders"]
+	if root.SpanKind() != trace.SpanKindServer || !root.Parent().IsRemote() {
+		t.Errorf("unexpected root: kind %v, parent %v", root.SpanKind(), root.Parent())
+	}
+	if v, _ := attr(root.Attributes(), "http.status_code"); v.Type() != attribute.INT64 || v.AsInt64() != 500 {
+		t.Errorf("expected an int status code, got %v", v)
+	}
+	if v, _ := attr(root.Attributes(), "tenant"); v.AsString() != "acme" {
+		t.Errorf("expected the trace attributes on the root span, got %v", root.Attributes())
+	}
+
+	client := byName["HTTP: GET inventory"]
+	if client.SpanKind() != trace.SpanKindClient {
+		t.Errorf("expected a client span, got %v", client.SpanKind())
+	}
+	if client.Status().Code != codes.Error || client.Status().Description != "connection refused" {
+		t.Errorf("unexpected status: %+v", client.Status())
+	}
+	if l := client.Links(); len(l) != 1 || l[0].SpanContext.TraceID().String() != link.TraceID || l[0].SpanContext.SpanID().String() != link.SpanID {
+		t.Errorf("unexpected links: %+v", l)
+	}
+	events := client.Events()
+	if len(events) != 1 || events[0].Name != "retry" || !events[0].Time.Equal(tr.Spans[1].Events[0].Time) {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if v, _ := attr(events[0].Attributes, "attempt"); v.Type() != attribute.STRING || v.AsString() != "2" {
+		t.Errorf("unexpected event attributes: %v", events[0].Attributes)
+	}
+	if v, _ := attr(client.Attributes(), "order.id"); v.Type() != attribute.STRING {
+		t.Errorf("untyped tags must stay strings, got %v", v.Type())
+	}
+	if v, _ := attr(client.Attributes(), "ratio"); v.Type() != attribute.FLOAT64 {
+		t.Errorf("expected a float attribute, got %v", v.Type())
+	}
+	if v, _ := attr(client.Attributes(), "cache.hit"); v.Type() != attribute.BOOL || v.AsBool() {
+		t.Errorf("expected a bool attribute, got %v", v.Type())
+	}
+	if byName["parse"].SpanKind() != trace.SpanKindInternal {
+		t.Errorf("expected an internal span, got %v", byName["parse"].SpanKind())
+	}
+}
+
+func TestExport_WithoutIDGenerator(t *testing.T) {
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp))
+	ctx, end := tracer.StartTrace(context.Background(), "job")
+	_, finish := flowtracker.StartSpan(ctx, "step")
+	finish()
+	end()
+	tr := exp.next(t)
+
+	// A span whose parent is unknown is attached to the root
+	tr.Spans = append(tr.Spans, &flowtracker.Span{ID: "1111111111111111", ParentID: "2222222222222222", Name: "orphan"})
+
+	sr := tracetest.NewSpanRecorder()
+	New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))).Export(tr)
+
+	ended := sr.Ended()
+	if len(ended) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(ended))
+	}
+	root := ended[0]
+	for _, s := range ended[1:] {
+		if s.Parent().SpanID() != root.SpanContext().SpanID() || s.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %q is not a child of the root", s.Name())
+		}
+	}
+	// The original IDs are still available as attributes
+	if v, _ := attr(root.Attributes(), "flowtracker.trace_id"); v.AsString() != tr.TraceID {
+		t.Errorf("expected the FlowTracker trace ID attribute, got %v", v)
+	}
+}
+
+func TestIDGenerator_RandomFallback(t *testing.T) {
+	gen := IDGenerator()
+	tid, sid := gen.NewIDs(context.Background())
+	if !tid.IsValid() || !sid.IsValid() {
+		t.Errorf("expected random valid IDs, got %s/%s", tid, sid)
+	}
+	if other := gen.NewSpanID(context.Background(), tid); !other.IsValid() || other == sid {
+		t.Errorf("expected a new random span ID, got %s", other)
+	}
+}
+
+func TestExport_ProviderResource(t *testing.T) {
+	exp := make(chanExporter, 1)
+	res := flowtracker.Resource{ServiceName: "checkout", Environment: "prod"}
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp), flowtracker.WithResource(res))
+	_, end := tracer.StartTrace(context.Background(), "GET /checkout")
+	end()
+	tr := exp.next(t)
+
+	// The provider is built from the trace's resource, as documented on New
+	sr := tracetest.NewSpanRecorder()
+	New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr), sdktrace.WithResource(NewResource(tr.Resource)))).Export(tr)
+
+	ended := sr.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(ended))
+	}
+	attrs := ended[0].Resource().Attributes()
+	if v, _ := attr(attrs, "service.name"); v.AsString() != "checkout" {
+		t.Errorf("expected service.name checkout, got %v", v)
+	}
+	if v, _ := attr(attrs, "deployment.environment.name"); v.AsString() != "prod" {
+		t.Errorf("expected deployment.environment.name prod, got %v", v)
+	}
+}
@@ -0,0 +1,147 @@
+package otel
+
+import (
+	"context"
+	"sync"
+
+	"github.com/spdeepak/flowtracker"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanProcessor is an OTel sdktrace.SpanProcessor that adds OTel spans ending inside a
+// FlowTracker-traced request to the live Trace as child spans. The FlowTracker exporters
+// (Mermaid, Sankey, ...) then show the work of OTel-instrumented libraries too.
+//
+// Example:
+//
+//	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(otelexporter.NewSpanProcessor()))
+//
+// Spans that end after the FlowTracker trace was exported are not added.
+// Don't export the same trace through OTelExporter, or the OTel spans are sent twice.
+type SpanProcessor struct {
+	// pending holds the spans started inside a FlowTracker trace until they end
+	pending sync.Map // trace.SpanID -> pendingSpan
+}
+
+type pendingSpan struct {
+	trace    *flowtracker.Trace
+	parentID string
+}
+
+var _ sdktrace.SpanProcessor = (*SpanProcessor)(nil)
+
+// NewSpanProcessor creates a SpanProcessor.
+func NewSpanProcessor() *SpanProcessor {
+	return &SpanProcessor{}
+}
+
+// OnStart remembers spans started from a context carrying a FlowTracker trace.
+func (p *SpanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	tr, ok := flowtracker.TraceFromContext(parent)
+	if !ok {
+		return
+	}
+
+	// The OTel parent is the closer one if it's part of the same tree: a span of the
+	// FlowTracker trace (see WithContextInterop) or another pending OTel span.
+	// Otherwise the span belongs below the current FlowTracker span.
+	parentID := flowtracker.SpanContextFromContext(parent).SpanID
+	if psc := s.Parent(); psc.IsValid() {
+		_, tracked := p.pending.Load(psc.SpanID())
+		if tracked || psc.TraceID().String() == tr.TraceID {
+			parentID = psc.SpanID().String()
+		}
+	}
+	p.pending.Store(s.SpanContext().SpanID(), pendingSpan{trace: tr, parentID: parentID})
+}
+
+// OnEnd adds the finished span to its FlowTracker trace.
+func (p *SpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	v, ok := p.pending.LoadAndDelete(s.SpanContext().SpanID())
+	if !ok {
+		return
+	}
+	ps := v.(pendingSpan)
+	ps.trace.AddSpan(convertSpan(s, ps.parentID))
+}
+
+func (p *SpanProcessor) Shutdown(context.Context) error   { return nil }
+func (p *SpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// convertSpan maps an OTel span to a FlowTracker span.
+func convertSpan(s sdktrace.ReadOnlySpan, parentID string) *flowtracker.Span {
+	span := &flowtracker.Span{
+		ID:        s.SpanContext().SpanID().String(),
+		ParentID:  parentID,
+		Name:      s.Name(),
+		Kind:      flowtrackerKind(s.SpanKind()),
+		StartTime: s.StartTime(),
+		EndTime:   s.EndTime(),
+		Duration:  s.EndTime().Sub(s.StartTime()).Milliseconds(),
+		Tags:      map[string]string{"otel.scope.name": s.InstrumentationScope().Name},
+	}
+	for _, kv := range s.Attributes() {
+		span.Tags[string(kv.Key)] = kv.Value.Emit()
+		if typ := tagType(kv.Value); typ != flowtracker.TagTypeString {
+			if span.TagTypes == nil {
+				span.TagTypes = make(map[string]flowtracker.TagType)
+			}
+			span.TagTypes[string(kv.Key)] = typ
+		}
+	}
+	if st := s.Status(); st.Code == codes.Error {
+		span.Tags["error"] = "true"
+		if st.Description != "" {
+			span.Tags["error.message"] = st.Description
+		}
+	}
+	for _, ev := range s.Events() {
+		event := flowtracker.SpanEvent{Name: ev.Name, Time: ev.Time}
+		if len(ev.Attributes) > 0 {
+			event.Attributes = make(map[string]string, len(ev.Attributes))
+			for _, kv := range ev.Attributes {
+				event.Attributes[string(kv.Key)] = kv.Value.Emit()
+			}
+		}
+		span.Events = append(span.Events, event)
+	}
+	for _, l := range s.Links() {
+		span.Links = append(span.Links, flowtracker.SpanContext{
+			TraceID: l.SpanContext.TraceID().String(),
+			SpanID:  l.SpanContext.SpanID().String(),
+		})
+	}
+	return span
+}
+
+func flowtrackerKind(k trace.SpanKind) flowtracker.SpanKind {
+	switch k {
+	case trace.SpanKindServer:
+		return flowtracker.SpanKindServer
+	case trace.SpanKindClient:
+		return flowtracker.SpanKindClient
+	case trace.SpanKindProducer:
+		return flowtracker.SpanKindProducer
+	case trace.SpanKindConsumer:
+		return flowtracker.SpanKindConsumer
+	default:
+		return flowtracker.SpanKindInternal
+	}
+}
+
+// tagType keeps the type of bool and number attributes, other values are stored as strings.
+func tagType(v attribute.Value) flowtracker.TagType {
+	switch v.Type() {
+	case attribute.BOOL:
+		return flowtracker.TagTypeBool
+	case attribute.INT64:
+		return flowtracker.TagTypeInt
+	case attribute.FLOAT64:
+		return flowtracker.TagTypeFloat
+	}
+	return flowtracker.TagTypeString
+}
@@ -0,0 +1,104 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/spdeepak/flowtracker"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSpanProcessor_IngestsSpans(t *testing.T) {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(NewSpanProcessor()))
+	lib := tp.Tracer("aws-sdk")
+
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp))
+	ctx, end := tracer.StartTrace(context.Background(), "GET /orders")
+	ctx, finish := flowtracker.StartSpan(ctx, "Load Order")
+
+	callCtx, call := lib.Start(ctx, "DynamoDB.GetItem", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int("aws.retries", 2), attribute.String("aws.region", "eu-west-1")))
+	_, sign := lib.Start(callCtx, "sign request")
+	sign.End()
+	call.AddEvent("throttled", trace.WithAttributes(attribute.Bool("retry", true)))
+	call.RecordError(errors.New("ignored, only the status counts"))
+	call.SetStatus(codes.Error, "ProvisionedThroughputExceeded")
+	call.End()
+	finish()
+
+	// Started outside of the trace: not ingested
+	_, other := lib.Start(context.Background(), "background refresh")
+	other.End()
+
+	// Ends after the trace was exported: not ingested
+	_, late := lib.Start(ctx, "async audit")
+	end()
+	tr := exp.next(t)
+	late.End()
+
+	if len(tr.Spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(tr.Spans))
+	}
+	load, signed, dynamo := tr.Spans[1], tr.Spans[2], tr.Spans[3]
+	if signed.Name != "sign request" || dynamo.Name != "DynamoDB.GetItem" {
+		t.Fatalf("unexpected spans: %q, %q", signed.Name, dynamo.Name)
+	}
+	if dynamo.ParentID != load.ID || signed.ParentID != dynamo.ID {
+		t.Errorf("unexpected parents: %s below %s, %s below %s", dynamo.Name, dynamo.ParentID, signed.Name, signed.ParentID)
+	}
+	if dynamo.ID != call.SpanContext().SpanID().String() || dynamo.Kind != flowtracker.SpanKindClient {
+		t.Errorf("unexpected span: %+v", dynamo)
+	}
+	if !dynamo.StartTime.Before(dynamo.EndTime) || dynamo.EndTime.After(tr.Root.EndTime) {
+		t.Errorf("unexpected timestamps: %v - %v", dynamo.StartTime, dynamo.EndTime)
+	}
+	want := map[string]string{
+		"aws.retries":     "2",
+		"aws.region":      "eu-west-1",
+		"otel.scope.name": "aws-sdk",
+		"error":           "true",
+		"error.message":   "ProvisionedThroughputExceeded",
+	}
+	for k, v := range want {
+		if dynamo.Tags[k] != v {
+			t.Errorf("expected tag %s=%q, got %q", k, v, dynamo.Tags[k])
+		}
+	}
+	// Bool and number attributes keep their type
+	if dynamo.TagTypes["aws.retries"] != flowtracker.TagTypeInt || dynamo.TagTypes["aws.region"] != flowtracker.TagTypeString {
+		t.Errorf("unexpected tag types: %v", dynamo.TagTypes)
+	}
+	// RecordError adds an "exception" event
+	if len(dynamo.Events) != 2 || dynamo.Events[0].Name != "throttled" || dynamo.Events[0].Attributes["retry"] != "true" {
+		t.Errorf("unexpected events: %+v", dynamo.Events)
+	}
+}
+
+func TestSpanProcessor_WithContextInterop(t *testing.T) {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(NewSpanProcessor()), sdktrace.WithIDGenerator(IDGenerator()))
+	lib := tp.Tracer("otelhttp")
+
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp), WithContextInterop())
+	ctx, end := tracer.StartTrace(context.Background(), "GET /orders")
+	callCtx, call := lib.Start(ctx, "HTTP GET")
+	_, finish := flowtracker.StartSpan(callCtx, "Parse Response")
+	finish()
+	call.End()
+	end()
+	tr := exp.next(t)
+
+	if len(tr.Spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(tr.Spans))
+	}
+	parse, httpGet := tr.Spans[1], tr.Spans[2]
+	if httpGet.ParentID != tr.Root.ID || parse.ParentID != httpGet.ID {
+		t.Errorf("unexpected parents: %s below %s, %s below %s", httpGet.Name, httpGet.ParentID, parse.Name, parse.ParentID)
+	}
+}
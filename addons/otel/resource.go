@@ -0,0 +1,42 @@
+package otel
+
+import (
+	"github.com/spdeepak/flowtracker"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// ResourceAttributes maps a FlowTracker Resource to OTel semantic convention attributes.
+func ResourceAttributes(r *flowtracker.Resource) []attribute.KeyValue {
+	if r == nil {
+		return nil
+	}
+	var attrs []attribute.KeyValue
+	add := func(kv attribute.KeyValue) {
+		if kv.Value.AsString() != "" {
+			attrs = append(attrs, kv)
+		}
+	}
+	add(semconv.ServiceName(r.ServiceName))
+	add(semconv.ServiceVersion(r.ServiceVersion))
+	add(semconv.DeploymentEnvironmentName(r.Environment))
+	add(semconv.HostName(r.Host))
+	add(semconv.K8SPodName(r.Pod))
+	for k, v := range r.Attributes {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	return attrs
+}
+
+// NewResource builds the OTel resource for a TracerProvider from a FlowTracker Resource,
+// so spans exported through the bridge are attributed to the same service.
+//
+// Example:
+//
+//	res := otelexporter.NewResource(&resource)
+//	tp := sdktrace.NewTracerProvider(sdktrace.WithResource(res), ...)
+func NewResource(r *flowtracker.Resource) *resource.Resource {
+	return resource.NewWithAttributes(semconv.SchemaURL, ResourceAttributes(r)...)
+}
@@ -0,0 +1,124 @@
+package flowtracker
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ---------------------------------------------------------
+// Baggage (request-scoped key/values, W3C "baggage" header)
+// ---------------------------------------------------------
+
+const (
+	// BaggageHeader is the W3C header used to propagate baggage between services.
+	BaggageHeader = "baggage"
+
+	// MaxBaggageMembers is the maximum number of entries kept in the baggage.
+	MaxBaggageMembers = 64
+
+	// MaxBaggageBytes is the maximum size of the encoded baggage header.
+	MaxBaggageBytes = 8192
+)
+
+type baggage map[string]string
+
+// SetBaggage returns a copy of ctx whose baggage carries key=value.
+// Baggage flows to every span started from the returned context and to downstream
+// services through Inject. Entries that would push the baggage past
+// MaxBaggageMembers or MaxBaggageBytes are ignored.
+func SetBaggage(ctx context.Context, key, value string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	old, _ := ctx.Value(baggageKey).(baggage)
+
+	b := make(baggage, len(old)+1)
+	for k, v := range old {
+		b[k] = v
+	}
+	b[key] = value
+
+	if len(b) > MaxBaggageMembers || len(b.encode()) > MaxBaggageBytes {
+		return ctx
+	}
+	return context.WithValue(ctx, baggageKey, b)
+}
+
+// Baggage returns a copy of the baggage stored in ctx.
+func Baggage(ctx context.Context) map[string]string {
+	b, _ := ctx.Value(baggageKey).(baggage)
+	out := make(map[string]string, len(b))
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
+}
+
+// WithBaggageTags copies the current baggage onto every span as tags when the span starts.
+// Keys are prefixed with prefix, e.g. "baggage." turns "tenant" into "baggage.tenant".
+func WithBaggageTags(prefix string) Option {
+	return func(c *config) {
+		c.baggageTags = true
+		c.baggagePrefix = prefix
+	}
+}
+
+// applyBaggageTags copies ctx baggage onto the span if enabled.
+func (c *config) applyBaggageTags(ctx context.Context, span *Span) {
+	if c == nil || !c.baggageTags {
+		return
+	}
+	b, _ := ctx.Value(baggageKey).(baggage)
+	if len(b) == 0 {
+		return
+	}
+	if span.Tags == nil {
+		span.Tags = make(map[string]string, len(b))
+	}
+	for k, v := range b {
+		span.Tags[c.baggagePrefix+k] = v
+	}
+}
+
+// encode renders the baggage in W3C format with keys sorted for a stable output.
+func (b baggage) encode() string {
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, url.PathEscape(k)+"="+url.PathEscape(b[k]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// baggageMember is one key/value of a baggage header.
+type baggageMember struct {
+	key, value string
+}
+
+// parseBaggage decodes a W3C baggage header into its members in header order, so the
+// limits keep the same members on every request. Properties (";prop") are ignored,
+// as are malformed members.
+func parseBaggage(header string) []baggageMember {
+	var out []baggageMember
+	for _, member := range strings.Split(header, ",") {
+		member, _, _ = strings.Cut(member, ";")
+		k, v, ok := strings.Cut(member, "=")
+		if !ok {
+			continue
+		}
+		k, errK := url.PathUnescape(strings.TrimSpace(k))
+		v, errV := url.PathUnescape(strings.TrimSpace(v))
+		if errK != nil || errV != nil || k == "" {
+			continue
+		}
+		out = append(out, baggageMember{key: k, value: v})
+	}
+	return out
+}
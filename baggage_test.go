@@ -0,0 +1,146 @@
+package flowtracker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBaggage_SetAndCopy(t *testing.T) {
+	ctx := SetBaggage(context.Background(), "tenant", "acme")
+	child := SetBaggage(ctx, "tier", "gold")
+
+	if got := Baggage(ctx); len(got) != 1 || got["tenant"] != "acme" {
+		t.Errorf("parent baggage should be untouched, got %v", got)
+	}
+	got := Baggage(child)
+	if got["tenant"] != "acme" || got["tier"] != "gold" {
+		t.Errorf("unexpected child baggage: %v", got)
+	}
+
+	// The returned map is a copy
+	got["tenant"] = "other"
+	if Baggage(child)["tenant"] != "acme" {
+		t.Error("modifying the returned map must not change the context baggage")
+	}
+}
+
+func TestBaggage_Limits(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < MaxBaggageMembers+10; i++ {
+		ctx = SetBaggage(ctx, fmt.Sprintf("k%d", i), "v")
+	}
+	if n := len(Baggage(ctx)); n != MaxBaggageMembers {
+		t.Errorf("expected %d members, got %d", MaxBaggageMembers, n)
+	}
+
+	ctx = SetBaggage(context.Background(), "big", strings.Repeat("x", MaxBaggageBytes))
+	if _, ok := Baggage(ctx)["big"]; ok {
+		t.Error("expected oversized entry to be ignored")
+	}
+}
+
+func TestBaggage_HeaderRoundTrip(t *testing.T) {
+	h := http.Header{}
+	h.Set(BaggageHeader, "tenant=acme, cohort=beta%20users;ttl=60,broken")
+
+	ctx := ExtractHeaders(context.Background(), h)
+	b := Baggage(ctx)
+	if len(b) != 2 || b["tenant"] != "acme" || b["cohort"] != "beta users" {
+		t.Fatalf("unexpected parsed baggage: %v", b)
+	}
+
+	out := http.Header{}
+	InjectHeaders(ctx, out)
+	if got := out.Get(BaggageHeader); got != "cohort=beta%20users,tenant=acme" {
+		t.Errorf("unexpected encoded baggage: %q", got)
+	}
+}
+
+func TestBaggage_ExtractAtLimits(t *testing.T) {
+	// Members beyond the limits are dropped in header order, the same on every request
+	members := make([]string, 0, MaxBaggageMembers+10)
+	for i := 0; i < MaxBaggageMembers+10; i++ {
+		members = append(members, fmt.Sprintf("k%d=v", i))
+	}
+	for run := 0; run < 20; run++ {
+		h := http.Header{}
+		h.Set(BaggageHeader, strings.Join(members, ","))
+		b := Baggage(ExtractHeaders(context.Background(), h))
+		if len(b) != MaxBaggageMembers {
+			t.Fatalf("expected %d members, got %d", MaxBaggageMembers, len(b))
+		}
+		for i := 0; i < MaxBaggageMembers; i++ {
+			if _, ok := b[fmt.Sprintf("k%d", i)]; !ok {
+				t.Fatalf("run %d: expected the first %d members, k%d is missing", run, MaxBaggageMembers, i)
+			}
+		}
+	}
+
+	// Members that would exceed MaxBaggageBytes are skipped, the later ones that fit are kept
+	big := strings.Repeat("x", MaxBaggageBytes/2)
+	for run := 0; run < 20; run++ {
+		h := http.Header{}
+		h.Set(BaggageHeader, "a="+big+",b="+big+",c=small")
+		b := Baggage(ExtractHeaders(context.Background(), h))
+		if _, ok := b["a"]; !ok || len(b) != 2 || b["c"] != "small" {
+			t.Fatalf("run %d: expected a and c, got keys %v", run, keys(b))
+		}
+	}
+}
+
+// keys returns the keys of m, for failure messages.
+func keys(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+func TestMiddleware_BaggagePropagation(t *testing.T) {
+	// Downstream service records the baggage it receives
+	var received string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(BaggageHeader)
+	}))
+	defer downstream.Close()
+
+	exp := newChanExporter()
+	mw := NewMiddleware(WithExporter(exp), WithBaggageTags("baggage."))
+	client := &http.Client{Transport: &Transport{}}
+
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := SetBaggage(r.Context(), "tier", "gold")
+		ctx, finish := StartSpan(ctx, "HTTP: Downstream")
+		defer finish()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("downstream call failed: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(BaggageHeader, "tenant=acme")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if received != "tenant=acme,tier=gold" {
+		t.Errorf("unexpected baggage sent downstream: %q", received)
+	}
+
+	tr := exp.next(t)
+	if got := tr.Root.Tags["baggage.tenant"]; got != "acme" {
+		t.Errorf("expected root span to carry incoming baggage, got %v", tr.Root.Tags)
+	}
+	child := tr.Spans[1]
+	if child.Tags["baggage.tenant"] != "acme" || child.Tags["baggage.tier"] != "gold" {
+		t.Errorf("expected child span to carry all baggage, got %v", child.Tags)
+	}
+}
@@ -0,0 +1,51 @@
+package exporters
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// traceBatcher collects traces for exporters that send several traces per request.
+type traceBatcher struct {
+	mu    sync.Mutex
+	batch []*flowtracker.Trace
+	timer *time.Timer
+}
+
+// add appends tr and returns the batch once it holds size traces. The first trace of an
+// incomplete batch schedules flush after timeout (default 5s).
+func (b *traceBatcher) add(tr *flowtracker.Trace, size int, timeout time.Duration, flush func()) []*flowtracker.Trace {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.batch = append(b.batch, tr)
+	if len(b.batch) >= size {
+		return b.takeLocked()
+	}
+	if b.timer == nil {
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		b.timer = time.AfterFunc(timeout, flush)
+	}
+	return nil
+}
+
+// take returns and resets the current batch.
+func (b *traceBatcher) take() []*flowtracker.Trace {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.takeLocked()
+}
+
+func (b *traceBatcher) takeLocked() []*flowtracker.Trace {
+	batch := b.batch
+	b.batch = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return batch
+}
@@ -0,0 +1,230 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// ChromeTraceExporter writes traces in the Chrome Trace Event Format, to open them in
+// chrome://tracing or https://ui.perfetto.dev with their real timing.
+//
+// Every span becomes a complete ("X") event. Spans that overlap without nesting, e.g.
+// parallel siblings, are put on separate thread lanes so they don't collide.
+type ChromeTraceExporter struct {
+	// Dir writes every trace to its own "<trace_id>.json" file in this directory.
+	Dir string
+
+	// Filename appends every trace to this file if Dir is empty. Default "traces.chrome.json"
+	Filename string
+
+	// MaxFileSize rolls Filename over to Filename+".1" once it grows beyond this many
+	// bytes, replacing the previous one. Default 100MB
+	MaxFileSize int64
+
+	mu sync.Mutex
+}
+
+// chromeEvent is one entry of the Trace Event Format.
+type chromeEvent struct {
+	Name  string            `json:"name"`
+	Cat   string            `json:"cat,omitempty"`
+	Ph    string            `json:"ph"`
+	Ts    int64             `json:"ts"`
+	Dur   *int64            `json:"dur,omitempty"`
+	Pid   int               `json:"pid"`
+	Tid   int               `json:"tid"`
+	Scope string            `json:"s,omitempty"`
+	Args  map[string]string `json:"args,omitempty"`
+}
+
+func (c *ChromeTraceExporter) Export(tr *flowtracker.Trace) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Dir != "" {
+		b, err := json.Marshal(map[string]any{
+			"traceEvents":     chromeEvents(tr, chromePid(tr.TraceID)),
+			"displayTimeUnit": "ms",
+		})
+		if err == nil {
+			err = os.WriteFile(filepath.Join(c.Dir, tr.TraceID+".json"), b, 0644)
+		}
+		if err != nil {
+			fmt.Printf("Error writing chrome trace: %v\n", err)
+		}
+		return
+	}
+
+	if err := c.append(tr); err != nil {
+		fmt.Printf("Error writing chrome trace: %v\n", err)
+	}
+}
+
+// append adds the events to the rolling file. It uses the JSON Array Format, where the
+// closing bracket is optional, so events can be appended without rewriting the file.
+func (c *ChromeTraceExporter) append(tr *flowtracker.Trace) error {
+	filename := c.Filename
+	if filename == "" {
+		filename = "traces.chrome.json"
+	}
+	maxSize := c.MaxFileSize
+	if maxSize <= 0 {
+		maxSize = 100 << 20
+	}
+	if info, err := os.Stat(filename); err == nil && info.Size() >= maxSize {
+		if err := os.Rename(filename, filename+".1"); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	if info.Size() == 0 {
+		buf = append(buf, "[\n"...)
+	}
+	// Each trace gets its own process, so traces sharing the file get their own track group
+	for _, ev := range chromeEvents(tr, chromePid(tr.TraceID)) {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, b...)
+		buf = append(buf, ",\n"...)
+	}
+	_, err = file.Write(buf)
+	return err
+}
+
+// chromePid derives the process of a trace from its ID, so traces appended to the
+// same file by different runs of the application don't share a process.
+func chromePid(traceID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(traceID))
+	return int(h.Sum32() & 0x7fffffff)
+}
+
+// chromeEvents converts a trace to events of process pid. Timestamps are microseconds
+// since the Unix epoch, so traces in one file line up on a common timeline.
+func chromeEvents(tr *flowtracker.Trace, pid int) []chromeEvent {
+	spans := append([]*flowtracker.Span(nil), tr.Spans...)
+	// Parents before their children: by start, the longer span first
+	sort.SliceStable(spans, func(i, j int) bool {
+		if !spans[i].StartTime.Equal(spans[j].StartTime) {
+			return spans[i].StartTime.Before(spans[j].StartTime)
+		}
+		return spans[i].EndTime.After(spans[j].EndTime)
+	})
+
+	name := tr.TraceID
+	if tr.Root != nil {
+		name = fmt.Sprintf("%s (%s)", tr.Root.Name, tr.TraceID)
+	}
+	events := []chromeEvent{{
+		Name: "process_name", Ph: "M", Pid: pid,
+		Args: map[string]string{"name": name},
+	}}
+
+	lanes := assignLanes(spans)
+	for lane := range maxLane(lanes) + 1 {
+		events = append(events, chromeEvent{
+			Name: "thread_name", Ph: "M", Pid: pid, Tid: lane,
+			Args: map[string]string{"name": fmt.Sprintf("lane %d", lane)},
+		})
+	}
+
+	for _, s := range spans {
+		dur := s.EndTime.Sub(s.StartTime).Microseconds()
+		args := make(map[string]string, len(s.Tags)+2)
+		for k, v := range s.Tags {
+			args[k] = v
+		}
+		args["span_id"] = s.ID
+		if s.ParentID != "" {
+			args["parent_id"] = s.ParentID
+		}
+		cat := string(s.Kind)
+		if cat == "" {
+			cat = string(flowtracker.SpanKindInternal)
+		}
+		events = append(events, chromeEvent{
+			Name: s.Name, Cat: cat, Ph: "X",
+			Ts: s.StartTime.UnixMicro(), Dur: &dur,
+			Pid: pid, Tid: lanes[s], Args: args,
+		})
+		for _, ev := range s.Events {
+			events = append(events, chromeEvent{
+				Name: ev.Name, Cat: "event", Ph: "i", Scope: "t",
+				Ts:  ev.Time.UnixMicro(),
+				Pid: pid, Tid: lanes[s], Args: ev.Attributes,
+			})
+		}
+	}
+	return events
+}
+
+// assignLanes gives every span a thread lane. Complete events on one lane must nest
+// properly, so a span stays on its parent's lane while the parent is the innermost open
+// span there, and otherwise moves to the first free lane.
+// spans must be sorted by start time.
+func assignLanes(spans []*flowtracker.Span) map[*flowtracker.Span]int {
+	lanes := make(map[*flowtracker.Span]int, len(spans))
+	byID := make(map[string]*flowtracker.Span, len(spans))
+	var stacks [][]*flowtracker.Span
+
+	// open returns the innermost span still running on the lane when s starts
+	open := func(lane int, s *flowtracker.Span) *flowtracker.Span {
+		stack := stacks[lane]
+		for len(stack) > 0 && !stack[len(stack)-1].EndTime.After(s.StartTime) {
+			stack = stack[:len(stack)-1]
+		}
+		stacks[lane] = stack
+		if len(stack) == 0 {
+			return nil
+		}
+		return stack[len(stack)-1]
+	}
+
+	for _, s := range spans {
+		lane := -1
+		if parent, ok := byID[s.ParentID]; ok && open(lanes[parent], s) == parent && !parent.EndTime.Before(s.EndTime) {
+			lane = lanes[parent]
+		}
+		for i := 0; lane < 0 && i < len(stacks); i++ {
+			if open(i, s) == nil {
+				lane = i
+			}
+		}
+		if lane < 0 {
+			lane = len(stacks)
+			stacks = append(stacks, nil)
+		}
+		stacks[lane] = append(stacks[lane], s)
+		lanes[s] = lane
+		byID[s.ID] = s
+	}
+	return lanes
+}
+
+func maxLane(lanes map[*flowtracker.Span]int) int {
+	m := 0
+	for _, l := range lanes {
+		m = max(m, l)
+	}
+	return m
+}
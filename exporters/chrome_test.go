@@ -0,0 +1,79 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChromeTraceExporter_Dir(t *testing.T) {
+	dir := t.TempDir()
+	(&ChromeTraceExporter{Dir: dir}).Export(parallelTrace())
+
+	b, err := os.ReadFile(filepath.Join(dir, "4bf92f3577b34da6a3ce929d0e0e4736.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("invalid trace file: %v", err)
+	}
+
+	lanes := map[string]int{}
+	for _, ev := range out.TraceEvents {
+		if ev.Ph != "X" {
+			continue
+		}
+		lanes[ev.Name] = ev.Tid
+		if ev.Name == "Load Order" && (ev.Ts != 1700000000010000 || *ev.Dur != 40000) {
+			t.Errorf("unexpected timing: ts=%d dur=%d", ev.Ts, *ev.Dur)
+		}
+	}
+	want := map[string]int{"GET /orders": 0, "Load Order": 0, "Load Customer": 1, "Render": 0}
+	for name, lane := range want {
+		if lanes[name] != lane {
+			t.Errorf("expected %q on lane %d, got %d", name, lane, lanes[name])
+		}
+	}
+}
+
+func TestChromeTraceExporter_RollingFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "traces.json")
+	exp := &ChromeTraceExporter{Filename: filename}
+	exp.Export(parallelTrace())
+	// Another exporter, e.g. after a restart, appends to the same file
+	second := parallelTrace()
+	second.TraceID = "0af7651916cd43dd8448eb211c80319c"
+	(&ChromeTraceExporter{Filename: filename}).Export(second)
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file is an unterminated JSON array, close it to parse it
+	var events []chromeEvent
+	if err := json.Unmarshal(append(bytes.TrimSuffix(b, []byte(",\n")), ']'), &events); err != nil {
+		t.Fatalf("invalid trace file: %v", err)
+	}
+	pids := map[int]bool{}
+	for _, ev := range events {
+		pids[ev.Pid] = true
+	}
+	if len(pids) != 2 {
+		t.Errorf("expected a process per trace, got %v", pids)
+	}
+
+	// Beyond MaxFileSize the file is rolled over
+	exp.MaxFileSize = 1
+	exp.Export(parallelTrace())
+	if _, err := os.Stat(filename + ".1"); err != nil {
+		t.Errorf("expected a rolled file: %v", err)
+	}
+	if b, _ := os.ReadFile(filename); !bytes.HasPrefix(b, []byte("[\n")) {
+		t.Errorf("expected a new file, got %q", b)
+	}
+}
@@ -0,0 +1,228 @@
+package exporters
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// DOTExporter outputs the trace as a Graphviz digraph, for traces too large for Mermaid.
+// Render it with `dot -Tsvg trace.dot > trace.svg`.
+//
+// Edges get thicker and nodes redder the larger their share of the trace duration.
+type DOTExporter struct {
+	// RankDir is the Graphviz rankdir: "TB", "LR", "BT" or "RL". Default "TB".
+	RankDir string
+
+	// IncludeTags lists the tags shown below the span name and duration.
+	IncludeTags []string
+
+	// ClusterTag draws the spans sharing a value of this tag in one box, e.g. "component".
+	ClusterTag string
+
+	// CollapseSiblings merges the children of a span that have the same name into one
+	// node showing the count and the summed duration, e.g. the queries of an N+1 loop.
+	CollapseSiblings bool
+
+	// Writer receives the output. Default os.Stdout
+	Writer io.Writer
+
+	mu sync.Mutex
+}
+
+// DOTOptions configures RenderDOT, the fields work like those of DOTExporter.
+type DOTOptions struct {
+	RankDir          string
+	IncludeTags      []string
+	ClusterTag       string
+	CollapseSiblings bool
+}
+
+func (d *DOTExporter) Export(tr *flowtracker.Trace) {
+	graph, err := RenderDOT(tr, DOTOptions{
+		RankDir:          d.RankDir,
+		IncludeTags:      d.IncludeTags,
+		ClusterTag:       d.ClusterTag,
+		CollapseSiblings: d.CollapseSiblings,
+	})
+	if err != nil {
+		fmt.Printf("Error rendering dot graph: %v\n", err)
+		return
+	}
+	writeLocked(&d.mu, d.Writer, string(graph))
+}
+
+// dotNode is one node of the graph: a span, or several siblings if collapsed.
+type dotNode struct {
+	id       string
+	spans    []*flowtracker.Span
+	duration time.Duration
+	children []*dotNode
+}
+
+// RenderDOT returns the Graphviz digraph of the trace.
+func RenderDOT(tr *flowtracker.Trace, opts DOTOptions) ([]byte, error) {
+	if tr == nil {
+		return nil, errNilTrace
+	}
+
+	// Each row of the span tree follows its parent, the path holds its ancestors
+	children := make(map[string][]*flowtracker.Span)
+	var roots, path []*flowtracker.Span
+	for _, row := range spanTree(tr) {
+		path = append(path[:row.Depth], row.Span)
+		if row.Depth == 0 {
+			roots = append(roots, row.Span)
+			continue
+		}
+		parent := path[row.Depth-1]
+		children[parent.ID] = append(children[parent.ID], row.Span)
+	}
+
+	// The share of a span is relative to the whole trace
+	var total time.Duration
+	if tr.Root != nil {
+		total = tr.Root.EndTime.Sub(tr.Root.StartTime)
+	}
+	for _, s := range roots {
+		total = max(total, s.EndTime.Sub(s.StartTime))
+	}
+
+	var nodes []*dotNode
+	var build func(group []*flowtracker.Span) *dotNode
+	build = func(group []*flowtracker.Span) *dotNode {
+		n := &dotNode{id: fmt.Sprintf("n%d", len(nodes)), spans: group}
+		nodes = append(nodes, n)
+		var kids []*flowtracker.Span
+		for _, s := range group {
+			n.duration += s.EndTime.Sub(s.StartTime)
+			kids = append(kids, children[s.ID]...)
+		}
+		for _, g := range groupSiblings(kids, opts.CollapseSiblings) {
+			n.children = append(n.children, build(g))
+		}
+		return n
+	}
+	var top []*dotNode
+	for _, g := range groupSiblings(roots, opts.CollapseSiblings) {
+		top = append(top, build(g))
+	}
+
+	share := func(n *dotNode) float64 {
+		if total <= 0 {
+			return 0
+		}
+		return min(float64(n.duration)/float64(total), 1)
+	}
+
+	rankDir := opts.RankDir
+	if rankDir == "" {
+		rankDir = "TB"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %s {\n", dotQuote("trace "+tr.TraceID))
+	fmt.Fprintf(&sb, "  rankdir=%s;\n", rankDir)
+	sb.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\"];\n")
+	sb.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+
+	// Nodes, grouped into clusters by tag value in order of appearance
+	var clusters []string
+	byCluster := make(map[string][]*dotNode)
+	for _, n := range nodes {
+		c := ""
+		if opts.ClusterTag != "" {
+			c = n.spans[0].Tags[opts.ClusterTag]
+		}
+		if _, ok := byCluster[c]; !ok {
+			clusters = append(clusters, c)
+		}
+		byCluster[c] = append(byCluster[c], n)
+	}
+	for i, c := range clusters {
+		indent := "  "
+		if c != "" {
+			fmt.Fprintf(&sb, "  subgraph cluster_%d {\n    label=%s;\n    style=dashed;\n", i, dotQuote(c))
+			indent = "    "
+		}
+		for _, n := range byCluster[c] {
+			// White to red by share, as a Graphviz HSV color
+			fmt.Fprintf(&sb, "%s%s [label=%s, fillcolor=\"0.000 %.3f 1.000\"%s];\n",
+				indent, n.id, dotQuote(dotLabel(n, opts.IncludeTags)), share(n)*0.8, dotErrorStyle(n))
+		}
+		if c != "" {
+			sb.WriteString("  }\n")
+		}
+	}
+
+	// Edges, thicker by share
+	var edges func(n *dotNode)
+	edges = func(n *dotNode) {
+		for _, child := range n.children {
+			fmt.Fprintf(&sb, "  %s -> %s [label=%s, penwidth=%.2f];\n",
+				n.id, child.id, dotQuote(fmt.Sprintf("%dms", child.duration.Milliseconds())), 1+7*share(child))
+			edges(child)
+		}
+	}
+	for _, n := range top {
+		edges(n)
+	}
+	sb.WriteString("}\n")
+	return []byte(sb.String()), nil
+}
+
+// groupSiblings returns one group per span, or per span name if collapse is set.
+// Groups keep the order of their first span.
+func groupSiblings(spans []*flowtracker.Span, collapse bool) [][]*flowtracker.Span {
+	var groups [][]*flowtracker.Span
+	index := make(map[string]int)
+	for _, s := range spans {
+		if collapse {
+			if i, ok := index[s.Name]; ok {
+				groups[i] = append(groups[i], s)
+				continue
+			}
+			index[s.Name] = len(groups)
+		}
+		groups = append(groups, []*flowtracker.Span{s})
+	}
+	return groups
+}
+
+// dotLabel shows the name, the duration and the tags shared by all spans of the node.
+func dotLabel(n *dotNode, tags []string) string {
+	first := n.spans[0]
+	lines := []string{first.Name}
+	if len(n.spans) > 1 {
+		lines[0] = fmt.Sprintf("%s ×%d", first.Name, len(n.spans))
+	}
+	lines = append(lines, fmt.Sprintf("%dms", n.duration.Milliseconds()))
+	for _, key := range tags {
+		val, ok := first.Tags[key]
+		for _, s := range n.spans[1:] {
+			ok = ok && s.Tags[key] == val
+		}
+		if ok {
+			lines = append(lines, fmt.Sprintf("%s:%s", key, val))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func dotErrorStyle(n *dotNode) string {
+	for _, s := range n.spans {
+		if s.Tags["error"] == "true" {
+			return ", color=\"red\", penwidth=2"
+		}
+	}
+	return ""
+}
+
+// dotQuote returns s as a quoted DOT string, line breaks become centered lines.
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
@@ -0,0 +1,48 @@
+package exporters
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDOTExporter(t *testing.T) {
+	var buf bytes.Buffer
+	(&DOTExporter{RankDir: "LR", IncludeTags: []string{"db.table"}, Writer: &buf}).Export(nPlusOneTrace())
+	graph := buf.String()
+
+	expected := []string{
+		`digraph "trace 4bf92f3577b34da6a3ce929d0e0e4736" {`,
+		`  rankdir=LR;`,
+		`  n0 [label="GET /orders\n100ms", fillcolor="0.000 0.800 1.000"];`,
+		`  n2 [label="Load Customer\n40ms", fillcolor="0.000 0.320 1.000", color="red", penwidth=2];`,
+		`  n4 [label="DB: Select Item\n8ms\ndb.table:items", fillcolor="0.000 0.064 1.000"];`,
+		`  n0 -> n1 [label="40ms", penwidth=3.80];`,
+		`  n3 -> n4 [label="8ms", penwidth=1.56];`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(graph, want+"\n") {
+			t.Errorf("expected %q in:\n%s", want, graph)
+		}
+	}
+	if strings.Count(graph, "DB: Select Item") != 3 {
+		t.Errorf("expected a node per query:\n%s", graph)
+	}
+}
+
+func TestRenderDOT_CollapseAndCluster(t *testing.T) {
+	graph, err := RenderDOT(nPlusOneTrace(), DOTOptions{CollapseSiblings: true, ClusterTag: "component"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(graph)
+	if !strings.Contains(out, `[label="DB: Select Item ×3\n24ms"`) || strings.Count(out, "DB: Select Item") != 1 {
+		t.Errorf("expected the queries collapsed into one node:\n%s", out)
+	}
+	if !strings.Contains(out, "  subgraph cluster_1 {\n    label=\"http\";\n    style=dashed;\n    n2 [") {
+		t.Errorf("expected a cluster per component:\n%s", out)
+	}
+	if !strings.Contains(out, "    label=\"db\";\n    style=dashed;\n    n4 [") {
+		t.Errorf("expected a cluster per component:\n%s", out)
+	}
+}
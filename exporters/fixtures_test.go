@@ -0,0 +1,77 @@
+package exporters
+
+import (
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// Traces shared by the exporter tests. Every span's Duration matches its StartTime
+// and EndTime, as it does for spans recorded by FlowTracker.
+
+// fixtureStart is the start of every fixture trace.
+var fixtureStart = time.Unix(1700000000, 0)
+
+// fixtureSpan returns a span running from..to after fixtureStart.
+func fixtureSpan(id, parent, name string, from, to time.Duration) *flowtracker.Span {
+	return &flowtracker.Span{
+		ID: id, ParentID: parent, Name: name,
+		StartTime: fixtureStart.Add(from),
+		EndTime:   fixtureStart.Add(to),
+		Duration:  (to - from).Milliseconds(),
+	}
+}
+
+// parallelTrace has two overlapping siblings and a third one after them.
+func parallelTrace() *flowtracker.Trace {
+	ms := time.Millisecond
+	root := fixtureSpan("00f067aa0ba902b7", "", "GET /orders", 0, 100*ms)
+	return &flowtracker.Trace{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		Root:    root,
+		Spans: []*flowtracker.Span{
+			fixtureSpan("53995c3f42cd8ad8", root.ID, "Load Order", 10*ms, 50*ms),
+			fixtureSpan("b7ad6b7169203331", root.ID, "Load Customer", 20*ms, 60*ms),
+			fixtureSpan("e457b5a2e4d86bd1", root.ID, "Render", 60*ms, 90*ms),
+			root,
+		},
+	}
+}
+
+// nPlusOneTrace runs the same query three times below the root.
+func nPlusOneTrace() *flowtracker.Trace {
+	tr := parallelTrace()
+	for i, id := range []string{"1000000000000001", "1000000000000002", "1000000000000003"} {
+		from := time.Duration(61+i*10) * time.Millisecond
+		query := fixtureSpan(id, tr.Spans[2].ID, "DB: Select Item", from, from+8*time.Millisecond)
+		query.Tags = map[string]string{"component": "db", "db.table": "items", "db.rows": "1"}
+		tr.Spans = append(tr.Spans, query)
+	}
+	tr.Spans[1].Tags = map[string]string{"error": "true", "component": "http"}
+	return tr
+}
+
+// otlpTestTrace continues a remote trace, with a failed root and a client span
+// carrying typed and untyped tags, an event and a link.
+func otlpTestTrace(traceID string) *flowtracker.Trace {
+	ms := time.Millisecond
+	root := fixtureSpan("00f067aa0ba902b7", "", "GET /orders", 0, 50*ms)
+	root.Kind = flowtracker.SpanKindServer
+	root.Tags = map[string]string{"http.status_code": "500", "error": "true", "error.message": "boom"}
+
+	child := fixtureSpan("53995c3f42cd8ad8", root.ID, "DB: Select", 1*ms, 20*ms)
+	child.Kind = flowtracker.SpanKindClient
+	child.Tags = map[string]string{"db.rows": "3", "cache.hit": "false", "ratio": "0.5", "db.system": "postgres", "order.id": "12345"}
+	child.TagTypes = map[string]flowtracker.TagType{"db.rows": flowtracker.TagTypeInt, "cache.hit": flowtracker.TagTypeBool, "ratio": flowtracker.TagTypeFloat}
+	child.Events = []flowtracker.SpanEvent{{Name: "retry", Time: fixtureStart.Add(2 * ms), Attributes: map[string]string{"attempt": "2"}}}
+	child.Links = []flowtracker.SpanContext{{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331"}}
+
+	return &flowtracker.Trace{
+		TraceID:        traceID,
+		RemoteParentID: "b9c7c989f97918e1",
+		Root:           root,
+		Spans:          []*flowtracker.Span{root, child},
+		Attributes:     map[string]string{"user.id": "42"},
+		Resource:       &flowtracker.Resource{ServiceName: "orders", Environment: "prod"},
+	}
+}
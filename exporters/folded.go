@@ -0,0 +1,234 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// FoldedStackExporter adds up the self time of every span path across all traces and
+// periodically writes the totals as folded stacks ("root;child;grandchild <self_time_us>").
+// Render the file with flamegraph.pl or drop it on https://www.speedscope.app to see where
+// time goes across many requests.
+//
+// Call Close on shutdown to stop the periodic writes and write the final totals.
+type FoldedStackExporter struct {
+	// Filename receives the folded stacks. Default "flowtracker.folded"
+	Filename string
+
+	// SpeedscopeFile also writes the totals in the speedscope JSON format, if set.
+	SpeedscopeFile string
+
+	// FlushInterval is the time between two writes. Default 1m
+	FlushInterval time.Duration
+
+	mu     sync.Mutex
+	stacks map[string]int64 // folded stack -> self time in µs
+	ticker flushTicker
+}
+
+func (f *FoldedStackExporter) Export(tr *flowtracker.Trace) {
+	f.ticker.run(f.flushInterval(), func() {
+		if err := f.Flush(); err != nil {
+			fmt.Printf("Error writing folded stacks: %v\n", err)
+		}
+	})
+
+	stacks := foldTrace(tr)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stacks == nil {
+		f.stacks = make(map[string]int64)
+	}
+	for stack, self := range stacks {
+		f.stacks[stack] += self
+	}
+}
+
+func (f *FoldedStackExporter) flushInterval() time.Duration {
+	if f.FlushInterval <= 0 {
+		return time.Minute
+	}
+	return f.FlushInterval
+}
+
+// Close stops the periodic writes and writes the final totals.
+func (f *FoldedStackExporter) Close() error {
+	f.ticker.close()
+	return f.Flush()
+}
+
+// Flush writes the totals collected so far. The files are replaced atomically.
+func (f *FoldedStackExporter) Flush() error {
+	f.mu.Lock()
+	stacks := make([]string, 0, len(f.stacks))
+	for stack := range f.stacks {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	weights := make([]int64, len(stacks))
+	for i, stack := range stacks {
+		weights[i] = f.stacks[stack]
+	}
+	f.mu.Unlock()
+
+	var sb strings.Builder
+	for i, stack := range stacks {
+		fmt.Fprintf(&sb, "%s %d\n", stack, weights[i])
+	}
+	filename := f.Filename
+	if filename == "" {
+		filename = "flowtracker.folded"
+	}
+	if err := writeFileAtomic(filename, []byte(sb.String())); err != nil {
+		return err
+	}
+
+	if f.SpeedscopeFile == "" {
+		return nil
+	}
+	b, err := json.Marshal(newSpeedscopeFile(stacks, weights))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.SpeedscopeFile, b)
+}
+
+// foldTrace returns the self time in µs of every span path of the trace. The self time
+// is the part of a span not covered by any of its children.
+func foldTrace(tr *flowtracker.Trace) map[string]int64 {
+	stacks := make(map[string]int64)
+	rows := spanTree(tr)
+	children := make(map[string][]*flowtracker.Span)
+	for _, r := range rows {
+		children[r.ParentID] = append(children[r.ParentID], r.Span)
+	}
+
+	// Rows are depth first, so a parent's path is known before its children's
+	paths := make(map[string]string, len(rows))
+	for _, r := range rows {
+		frame := strings.NewReplacer(";", ":", "\n", " ").Replace(r.Name)
+		path := frame
+		if parent, ok := paths[r.ParentID]; ok {
+			path = parent + ";" + frame
+		}
+		paths[r.ID] = path
+
+		self := r.EndTime.Sub(r.StartTime) - coveredTime(r.Span, children[r.ID])
+		if self > 0 {
+			stacks[path] += self.Microseconds()
+		}
+	}
+	return stacks
+}
+
+// coveredTime returns how much of the parent's duration the children cover together,
+// counting parallel children once.
+func coveredTime(parent *flowtracker.Span, children []*flowtracker.Span) time.Duration {
+	var covered time.Duration
+	var until time.Time
+	// children are sorted by start time
+	for _, c := range children {
+		from, to := c.StartTime, c.EndTime
+		if from.Before(parent.StartTime) {
+			from = parent.StartTime
+		}
+		if to.After(parent.EndTime) {
+			to = parent.EndTime
+		}
+		if from.Before(until) {
+			from = until
+		}
+		if to.After(from) {
+			covered += to.Sub(from)
+			until = to
+		}
+	}
+	return covered
+}
+
+// speedscopeFile is the speedscope file format with a single sampled profile, see
+// https://github.com/jlfwong/speedscope/wiki/Importing-from-custom-sources
+type speedscopeFile struct {
+	Schema   string              `json:"$schema"`
+	Shared   speedscopeShared    `json:"shared"`
+	Profiles []speedscopeProfile `json:"profiles"`
+	Name     string              `json:"name"`
+	Exporter string              `json:"exporter"`
+}
+
+type speedscopeShared struct {
+	Frames []speedscopeFrame `json:"frames"`
+}
+
+type speedscopeFrame struct {
+	Name string `json:"name"`
+}
+
+type speedscopeProfile struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name"`
+	Unit       string  `json:"unit"`
+	StartValue int64   `json:"startValue"`
+	EndValue   int64   `json:"endValue"`
+	Samples    [][]int `json:"samples"`
+	Weights    []int64 `json:"weights"`
+}
+
+// newSpeedscopeFile converts folded stacks into a speedscope file, every stack is a
+// sample weighted by its self time.
+func newSpeedscopeFile(stacks []string, weights []int64) speedscopeFile {
+	file := speedscopeFile{
+		Schema:   "https://www.speedscope.app/file-format-schema.json",
+		Name:     "flowtracker",
+		Exporter: "flowtracker",
+		Shared:   speedscopeShared{Frames: []speedscopeFrame{}},
+	}
+	profile := speedscopeProfile{Type: "sampled", Name: "flowtracker", Unit: "microseconds", Samples: [][]int{}, Weights: []int64{}}
+	frames := make(map[string]int)
+	for i, stack := range stacks {
+		var sample []int
+		for _, name := range strings.Split(stack, ";") {
+			idx, ok := frames[name]
+			if !ok {
+				idx = len(file.Shared.Frames)
+				frames[name] = idx
+				file.Shared.Frames = append(file.Shared.Frames, speedscopeFrame{Name: name})
+			}
+			sample = append(sample, idx)
+		}
+		profile.Samples = append(profile.Samples, sample)
+		profile.Weights = append(profile.Weights, weights[i])
+		profile.EndValue += weights[i]
+	}
+	file.Profiles = []speedscopeProfile{profile}
+	return file
+}
+
+// writeFileAtomic replaces the file, so readers never see a partial write.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,68 @@
+package exporters
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFoldedStackExporter(t *testing.T) {
+	dir := t.TempDir()
+	exp := &FoldedStackExporter{
+		Filename:       filepath.Join(dir, "traces.folded"),
+		SpeedscopeFile: filepath.Join(dir, "traces.speedscope.json"),
+	}
+	exp.Export(nPlusOneTrace())
+	exp.Export(nPlusOneTrace())
+	if err := exp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(exp.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Self time excludes the children, parallel ones counted once
+	expected := "GET /orders 40000\n" +
+		"GET /orders;Load Customer 80000\n" +
+		"GET /orders;Load Order 80000\n" +
+		"GET /orders;Render 12000\n" +
+		"GET /orders;Render;DB: Select Item 48000\n"
+	if string(b) != expected {
+		t.Errorf("unexpected folded stacks:\n%s", b)
+	}
+
+	b, err = os.ReadFile(exp.SpeedscopeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file speedscopeFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		t.Fatalf("invalid speedscope file: %v", err)
+	}
+	p := file.Profiles[0]
+	if len(file.Shared.Frames) != 5 || len(p.Samples) != 5 || p.EndValue != 260000 || p.Unit != "microseconds" {
+		t.Errorf("unexpected profile: %+v", file)
+	}
+	if last := p.Samples[4]; len(last) != 3 || file.Shared.Frames[last[2]].Name != "DB: Select Item" {
+		t.Errorf("unexpected sample %v", last)
+	}
+}
+
+func TestFoldedStackExporter_FlushInterval(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "traces.folded")
+	exp := &FoldedStackExporter{Filename: filename, FlushInterval: 10 * time.Millisecond}
+	defer exp.Close()
+	exp.Export(parallelTrace())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if b, _ := os.ReadFile(filename); len(b) > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("expected the stacks written after FlushInterval")
+}
@@ -0,0 +1,139 @@
+package exporters
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+//go:embed templates/waterfall.html
+var waterfallHTML string
+
+var waterfallTemplate = template.Must(template.New("waterfall").Parse(waterfallHTML))
+
+// HTMLExporter writes every trace to a standalone "<trace_id>.html" waterfall report.
+// The file has its CSS and JS inline and loads nothing from the network, so it can be
+// attached to a bug ticket.
+type HTMLExporter struct {
+	// Dir is the directory the reports are written to. Default: the working directory
+	Dir string
+}
+
+func (h *HTMLExporter) Export(tr *flowtracker.Trace) {
+	page, err := RenderHTML(tr)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(h.Dir, tr.TraceID+".html"), page, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Error writing html report: %v\n", err)
+	}
+}
+
+type htmlPage struct {
+	Title      string
+	TraceID    string
+	Service    string
+	Start      string
+	DurationMs float64
+	Rows       []htmlRow
+}
+
+type htmlRow struct {
+	ID          string
+	ParentID    string
+	Name        string
+	Indent      int
+	HasChildren bool
+	Error       bool
+	OffsetMs    float64
+	DurationMs  float64
+	LeftPct     float64
+	WidthPct    float64
+	Tags        []htmlKeyValue
+	Events      []htmlEvent
+}
+
+type htmlEvent struct {
+	Name       string
+	OffsetMs   float64
+	LeftPct    float64
+	Attributes []htmlKeyValue
+}
+
+type htmlKeyValue struct {
+	Key, Value string
+}
+
+// RenderHTML returns the waterfall report of the trace as a standalone HTML page.
+func RenderHTML(tr *flowtracker.Trace) ([]byte, error) {
+	if tr == nil {
+		return nil, errNilTrace
+	}
+	start, end := traceBounds(tr)
+	total := end.Sub(start)
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	pct := func(d time.Duration) float64 {
+		if total <= 0 {
+			return 0
+		}
+		return 100 * float64(d) / float64(total)
+	}
+
+	page := htmlPage{
+		Title:      tr.TraceID,
+		TraceID:    tr.TraceID,
+		Start:      start.Format(time.RFC3339Nano),
+		DurationMs: ms(total),
+	}
+	if tr.Root != nil {
+		page.Title = tr.Root.Name
+	}
+	if tr.Resource != nil {
+		page.Service = tr.Resource.ServiceName
+	}
+
+	for _, s := range spanTree(tr) {
+		row := htmlRow{
+			ID:          s.ID,
+			ParentID:    s.ParentID,
+			Name:        s.Name,
+			Indent:      8 + 16*s.Depth,
+			HasChildren: s.HasChildren,
+			Error:       s.Tags["error"] == "true",
+			OffsetMs:    ms(s.StartTime.Sub(start)),
+			DurationMs:  ms(s.EndTime.Sub(s.StartTime)),
+			LeftPct:     pct(s.StartTime.Sub(start)),
+			WidthPct:    pct(s.EndTime.Sub(s.StartTime)),
+			Tags:        htmlKeyValues(s.Tags),
+		}
+		for _, ev := range s.Events {
+			row.Events = append(row.Events, htmlEvent{
+				Name:       ev.Name,
+				OffsetMs:   ms(ev.Time.Sub(start)),
+				LeftPct:    pct(ev.Time.Sub(start)),
+				Attributes: htmlKeyValues(ev.Attributes),
+			})
+		}
+		page.Rows = append(page.Rows, row)
+	}
+
+	var buf bytes.Buffer
+	if err := waterfallTemplate.Execute(&buf, page); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func htmlKeyValues(m map[string]string) []htmlKeyValue {
+	kvs := make([]htmlKeyValue, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		kvs = append(kvs, htmlKeyValue{Key: k, Value: m[k]})
+	}
+	return kvs
+}
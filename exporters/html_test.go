@@ -0,0 +1,62 @@
+package exporters
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+func TestRenderHTML(t *testing.T) {
+	tr := nPlusOneTrace()
+	tr.Spans[0].Tags = map[string]string{"note": "<script>alert(1)</script>"}
+	tr.Spans[0].Events = []flowtracker.SpanEvent{{Name: "cache miss", Time: tr.Root.StartTime.Add(25 * time.Millisecond)}}
+
+	page, err := RenderHTML(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(page)
+
+	// Depth first: every span is followed by its descendants
+	names := regexp.MustCompile(`<span class="label" title="[0-9a-f]+">([^<]+)</span>`).FindAllStringSubmatch(html, -1)
+	var order []string
+	for _, m := range names {
+		order = append(order, m[1])
+	}
+	if strings.Join(order, ",") != "GET /orders,Load Order,Load Customer,Render,DB: Select Item,DB: Select Item,DB: Select Item" {
+		t.Errorf("unexpected row order: %v", order)
+	}
+	if !strings.Contains(html, `<tr class="span error" data-id="b7ad6b7169203331" data-parent="00f067aa0ba902b7">`) {
+		t.Error("expected the failed span highlighted")
+	}
+	if !strings.Contains(html, `<div class="bar" style="left: 10.0000%; width: 40.0000%"></div>`) {
+		t.Error("expected the bar of Load Order at its offset")
+	}
+	if !strings.Contains(html, `<div class="event" style="left: 25.0000%" title="cache miss +25.000ms"></div>`) {
+		t.Error("expected the event marker")
+	}
+	if strings.Contains(html, "<script>alert") || !strings.Contains(html, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Error("expected tag values escaped")
+	}
+	if strings.Contains(html, "http://") || strings.Contains(html, "https://") || strings.Contains(html, "src=") {
+		t.Error("expected a page without external resources")
+	}
+}
+
+func TestHTMLExporter(t *testing.T) {
+	dir := t.TempDir()
+	(&HTMLExporter{Dir: dir}).Export(parallelTrace())
+
+	b, err := os.ReadFile(filepath.Join(dir, "4bf92f3577b34da6a3ce929d0e0e4736.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "<!DOCTYPE html>") || !strings.Contains(string(b), "<title>GET /orders</title>") {
+		t.Errorf("unexpected report:\n%s", b)
+	}
+}
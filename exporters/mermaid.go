@@ -2,15 +2,23 @@ package exporters
 
 import (
 	"fmt"
+	"io"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spdeepak/flowtracker"
 )
 
-// MermaidExporter outputs the trace in Mermaid.js Flowchart syntax.
+// MermaidExporter outputs the trace in Mermaid.js syntax, as a Flowchart, a Gantt timeline
+// or a Sequence diagram.
 type MermaidExporter struct {
+	// Mode selects the diagram type. Default Flowchart.
+	Mode MermaidMode
+
 	// Orientation can be "TD" (Top-Down) or "LR" (Left-Right). Default "TD".
+	// Only used by Flowchart.
 	Orientation Orientation
 
 	// IncludeTags defines a specific list of tags to append to the span name.
@@ -20,6 +28,30 @@ type MermaidExporter struct {
 	// IncludeAllTags overrides IncludeTags. If true, ALL tags present
 	// in the span will be displayed in the diagram.
 	IncludeAllTags bool
+
+	// SectionTag groups the Gantt tasks into sections by the value of this tag.
+	// Default: one section per parent span.
+	SectionTag string
+
+	// ParticipantTag makes the values of this tag the participants of the Sequence
+	// diagram, e.g. "component" or "peer.service". Spans without the tag use the prefix
+	// of their name ("DB: Select User" is a call to "DB"), or stay with their parent.
+	ParticipantTag string
+
+	// Writer receives the output. Default os.Stdout
+	Writer io.Writer
+
+	mu sync.Mutex
+}
+
+// MermaidOptions configures RenderMermaid, the fields work like those of MermaidExporter.
+type MermaidOptions struct {
+	Mode           MermaidMode
+	Orientation    Orientation
+	IncludeTags    []string
+	IncludeAllTags bool
+	SectionTag     string
+	ParticipantTag string
 }
 
 type Orientation string
@@ -29,69 +61,81 @@ var (
 	LeftRight Orientation = "LR"
 )
 
+type MermaidMode string
+
+var (
+	// Flowchart draws the span tree with durations on the edges
+	Flowchart MermaidMode = "flowchart"
+	// Gantt draws every span as a task bar at its real start offset, showing what ran in parallel
+	Gantt MermaidMode = "gantt"
+	// Sequence draws the calls between components as a sequenceDiagram, ordered by start time
+	Sequence MermaidMode = "sequence"
+)
+
 // Export visual representation of output can be seen using https://mermaid.live/
 func (m *MermaidExporter) Export(tr *flowtracker.Trace) {
+	diagram, err := RenderMermaid(tr, MermaidOptions{
+		Mode:           m.Mode,
+		Orientation:    m.Orientation,
+		IncludeTags:    m.IncludeTags,
+		IncludeAllTags: m.IncludeAllTags,
+		SectionTag:     m.SectionTag,
+		ParticipantTag: m.ParticipantTag,
+	})
+	if err != nil {
+		fmt.Printf("Error rendering mermaid diagram: %v\n", err)
+		return
+	}
+
 	var sb strings.Builder
 
 	// 1. Header
 	sb.WriteString("\n----- MERMAID OUTPUT -----\n")
 	sb.WriteString("```mermaid\n")
+	sb.Write(diagram)
+
+	// 2. Footer
+	sb.WriteString("```\n")
+	sb.WriteString("--------------------------\n\n")
+
+	// 3. Write everything in one atomic operation
+	writeLocked(&m.mu, m.Writer, sb.String())
+}
 
+// RenderMermaid returns the Mermaid diagram of the trace, without the code fence.
+func RenderMermaid(tr *flowtracker.Trace, opts MermaidOptions) ([]byte, error) {
+	if tr == nil {
+		return nil, errNilTrace
+	}
+	var sb strings.Builder
+	switch opts.Mode {
+	case "", Flowchart:
+		opts.flowchart(&sb, tr)
+	case Gantt:
+		opts.gantt(&sb, tr)
+	case Sequence:
+		opts.sequence(&sb, tr)
+	default:
+		return nil, fmt.Errorf("exporters: unknown mermaid mode %q", opts.Mode)
+	}
+	return []byte(sb.String()), nil
+}
+
+// flowchart writes the span tree as "graph TD" with the durations on the edges.
+func (m MermaidOptions) flowchart(sb *strings.Builder, tr *flowtracker.Trace) {
 	orient := m.Orientation
 	if orient == "" {
 		orient = TopDown
 	}
 	sb.WriteString(fmt.Sprintf("graph %s\n", orient))
 
-	// 2. Helper to escape strings
-	escape := func(s string) string {
-		return strings.ReplaceAll(s, "\"", "'")
-	}
-
-	// 3. Pre-calculate Node Labels
+	// 2. Pre-calculate Node Labels
 	nodeLabels := make(map[string]string)
-
 	for _, span := range tr.Spans {
-		name := span.Name
-		var tagSuffixes []string
-
-		if span.Tags != nil && len(span.Tags) > 0 {
-			var keysToDisplay []string
-
-			// Logic: Decide which keys to show
-			if m.IncludeAllTags {
-				// Get ALL keys from the map
-				for k := range span.Tags {
-					keysToDisplay = append(keysToDisplay, k)
-				}
-				// Sort keys to ensure deterministic diagram output
-				sort.Strings(keysToDisplay)
-			} else if len(m.IncludeTags) > 0 {
-				// Get only user-specified keys
-				for _, k := range m.IncludeTags {
-					if _, exists := span.Tags[k]; exists {
-						keysToDisplay = append(keysToDisplay, k)
-					}
-				}
-				// No need to sort strict list, user order is preserved
-			}
-
-			// Build the display string
-			for _, key := range keysToDisplay {
-				val := span.Tags[key]
-				tagSuffixes = append(tagSuffixes, fmt.Sprintf("%s:%s", key, val))
-			}
-		}
-
-		// Append tags to name: "SpanName (key:val, key2:val)"
-		if len(tagSuffixes) > 0 {
-			name = fmt.Sprintf("%s (%s)", name, strings.Join(tagSuffixes, ", "))
-		}
-
-		nodeLabels[span.ID] = escape(name)
+		nodeLabels[span.ID] = strings.ReplaceAll(m.label(span), "\"", "'")
 	}
 
-	// 4. Build Links
+	// 3. Build Links
 	for _, span := range tr.Spans {
 		if span.ParentID == "" {
 			continue
@@ -111,10 +155,223 @@ func (m *MermaidExporter) Export(tr *flowtracker.Trace) {
 			span.ID, childLabel,
 		))
 	}
+}
 
-	// 5. Footer
-	sb.WriteString("```\n")
-	sb.WriteString("--------------------------\n\n")
+// gantt writes every span as a task bar. For traces shorter than a minute, start and end
+// are milliseconds since the trace started, so the axis shows the offset into the request.
+// Longer traces use Unix milliseconds and a wall clock axis, as Mermaid renders the
+// timestamps in the viewer's time zone and an offset would show up as a time of day.
+func (m MermaidOptions) gantt(sb *strings.Builder, tr *flowtracker.Trace) {
+	if len(tr.Spans) == 0 {
+		return
+	}
+	spans := append([]*flowtracker.Span(nil), tr.Spans...)
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].StartTime.Before(spans[j].StartTime)
+	})
+	traceStart, traceEnd := spans[0].StartTime, spans[0].EndTime
+	for _, span := range spans {
+		if span.EndTime.After(traceEnd) {
+			traceEnd = span.EndTime
+		}
+	}
+	base, axisFormat := traceStart, "%S.%L s"
+	if traceEnd.Sub(traceStart) >= time.Minute {
+		base, axisFormat = time.UnixMilli(0), "%H:%M:%S"
+	}
 
-	fmt.Print(sb.String())
+	names := make(map[string]string, len(spans))
+	for _, span := range spans {
+		names[span.ID] = span.Name
+	}
+
+	// Sections appear in the order their first span started
+	var sections []string
+	tasks := make(map[string][]*flowtracker.Span)
+	for _, span := range spans {
+		var section string
+		switch {
+		case m.SectionTag != "":
+			section = span.Tags[m.SectionTag]
+			if section == "" {
+				section = "other"
+			}
+		case span.ParentID == "" || names[span.ParentID] == "":
+			section = span.Name
+		default:
+			section = names[span.ParentID]
+		}
+		if _, ok := tasks[section]; !ok {
+			sections = append(sections, section)
+		}
+		tasks[section] = append(tasks[section], span)
+	}
+
+	sb.WriteString("gantt\n")
+	if tr.Root != nil {
+		sb.WriteString(fmt.Sprintf("    title %s\n", escapeMermaid(tr.Root.Name)))
+	}
+	sb.WriteString("    dateFormat x\n")
+	sb.WriteString(fmt.Sprintf("    axisFormat %s\n", axisFormat))
+	for _, section := range sections {
+		sb.WriteString(fmt.Sprintf("    section %s\n", escapeMermaid(section)))
+		for _, span := range tasks[section] {
+			status := ""
+			if span.Tags["error"] == "true" {
+				status = "crit, "
+			}
+			// Spans shorter than a millisecond get a bar of one, instead of none
+			start, end := span.StartTime.Sub(base).Milliseconds(), span.EndTime.Sub(base).Milliseconds()
+			end = max(end, start+1)
+			duration := fmt.Sprintf("%dms", span.Duration)
+			if span.EndTime.Sub(span.StartTime) < time.Millisecond {
+				duration = "<1ms"
+			}
+			// Syntax: Label (Duration) :status, id, start, end
+			sb.WriteString(fmt.Sprintf("    %s (%s) :%sN%s, %d, %d\n",
+				escapeMermaid(m.label(span)), duration, status, span.ID, start, end,
+			))
+		}
+	}
+}
+
+// sequence writes a call arrow when a span starts and a return arrow with its duration
+// when it ends. The root span is called by a "Client" participant.
+func (m MermaidOptions) sequence(sb *strings.Builder, tr *flowtracker.Trace) {
+	type message struct {
+		at    time.Time
+		seq   int
+		ret   bool
+		from  string
+		to    string
+		label string
+	}
+
+	// Parents before their children: by start, the longer span first
+	spans := append([]*flowtracker.Span(nil), tr.Spans...)
+	sort.SliceStable(spans, func(i, j int) bool {
+		if !spans[i].StartTime.Equal(spans[j].StartTime) {
+			return spans[i].StartTime.Before(spans[j].StartTime)
+		}
+		return spans[i].EndTime.After(spans[j].EndTime)
+	})
+
+	service := "Service"
+	if tr.Resource != nil && tr.Resource.ServiceName != "" {
+		service = tr.Resource.ServiceName
+	}
+
+	// Parents come before their children, so their participant is known first
+	participantOf := make(map[string]string, len(spans))
+	var participants []string
+	aliases := make(map[string]string)
+	alias := func(p string) string {
+		if _, ok := aliases[p]; !ok {
+			aliases[p] = fmt.Sprintf("P%d", len(participants))
+			participants = append(participants, p)
+		}
+		return aliases[p]
+	}
+	alias("Client")
+
+	var messages []message
+	for seq, span := range spans {
+		label := m.label(span)
+		parent, hasParent := participantOf[span.ParentID]
+		if !hasParent {
+			parent = "Client"
+		}
+
+		participant := span.Tags[m.ParticipantTag]
+		if m.ParticipantTag == "" || participant == "" {
+			if prefix, rest, ok := strings.Cut(span.Name, ":"); ok && strings.TrimSpace(prefix) != "" && !strings.Contains(prefix, " ") {
+				participant = prefix
+				label = strings.TrimSpace(rest) + strings.TrimPrefix(label, span.Name)
+			} else if hasParent {
+				participant = parent
+			} else {
+				participant = service
+			}
+		}
+		participantOf[span.ID] = participant
+
+		from, to := alias(parent), alias(participant)
+		messages = append(messages,
+			message{at: span.StartTime, seq: seq, from: from, to: to, label: label},
+			message{at: span.EndTime, seq: seq, ret: true, from: to, to: from, label: fmt.Sprintf("%dms", span.Duration)},
+		)
+	}
+
+	// At the same instant spans end before the next ones start, children return before
+	// their parents and parents call before their children
+	sort.Slice(messages, func(i, j int) bool {
+		a, b := messages[i], messages[j]
+		switch {
+		case !a.at.Equal(b.at):
+			return a.at.Before(b.at)
+		case a.ret != b.ret:
+			return a.ret
+		case a.ret:
+			return a.seq > b.seq
+		default:
+			return a.seq < b.seq
+		}
+	})
+
+	sb.WriteString("sequenceDiagram\n")
+	for _, p := range participants {
+		sb.WriteString(fmt.Sprintf("    participant %s as %s\n", aliases[p], escapeMermaid(p)))
+	}
+	for _, msg := range messages {
+		arrow := "->>"
+		if msg.ret {
+			arrow = "-->>"
+		}
+		sb.WriteString(fmt.Sprintf("    %s%s%s: %s\n", msg.from, arrow, msg.to, escapeMermaid(msg.label)))
+	}
+}
+
+// escapeMermaid replaces the characters that end a task name or message with Mermaid entity codes.
+func escapeMermaid(s string) string {
+	return strings.NewReplacer(":", "#58;", ";", "#59;", "\n", " ").Replace(s)
+}
+
+// label returns the span name followed by the selected tags.
+func (m MermaidOptions) label(span *flowtracker.Span) string {
+	name := span.Name
+	var tagSuffixes []string
+
+	if span.Tags != nil && len(span.Tags) > 0 {
+		var keysToDisplay []string
+
+		// Logic: Decide which keys to show
+		if m.IncludeAllTags {
+			// Get ALL keys from the map
+			for k := range span.Tags {
+				keysToDisplay = append(keysToDisplay, k)
+			}
+			// Sort keys to ensure deterministic diagram output
+			sort.Strings(keysToDisplay)
+		} else if len(m.IncludeTags) > 0 {
+			// Get only user-specified keys
+			for _, k := range m.IncludeTags {
+				if _, exists := span.Tags[k]; exists {
+					keysToDisplay = append(keysToDisplay, k)
+				}
+			}
+			// No need to sort strict list, user order is preserved
+		}
+
+		// Build the display string
+		for _, key := range keysToDisplay {
+			val := span.Tags[key]
+			tagSuffixes = append(tagSuffixes, fmt.Sprintf("%s:%s", key, val))
+		}
+	}
+
+	// Append tags to name: "SpanName (key:val, key2:val)"
+	if len(tagSuffixes) > 0 {
+		name = fmt.Sprintf("%s (%s)", name, strings.Join(tagSuffixes, ", "))
+	}
+	return name
 }
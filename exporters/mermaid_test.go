@@ -2,6 +2,7 @@ package exporters
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -157,3 +158,139 @@ func TestMermaidExporter_OK_IncludeTags(t *testing.T) {
 		t.Fatalf("expected log not found: %s", logs)
 	}
 }
+
+func TestMermaidExporter_Gantt(t *testing.T) {
+	tr := parallelTrace()
+	tr.Spans[1].Tags = map[string]string{"error": "true"}
+	tr.Spans[2].Name = "DB: Render"
+	var buf bytes.Buffer
+	(&MermaidExporter{Mode: Gantt, Writer: &buf}).Export(tr)
+	logs := buf.String()
+
+	expected := []string{
+		"```mermaid",
+		"gantt",
+		"    title GET /orders",
+		"    dateFormat x",
+		"    axisFormat %S.%L s",
+		"    section GET /orders",
+		"    GET /orders (100ms) :N00f067aa0ba902b7, 0, 100",
+		"    Load Order (40ms) :N53995c3f42cd8ad8, 10, 50",
+		"    Load Customer (40ms) :crit, Nb7ad6b7169203331, 20, 60",
+		"    DB#58; Render (30ms) :Ne457b5a2e4d86bd1, 60, 90",
+		"```",
+	}
+	lines := strings.Split(logs, "\n")[2:]
+	for i, want := range expected {
+		if i >= len(lines) || lines[i] != want {
+			t.Fatalf("line %d: expected %q, got:\n%s", i, want, logs)
+		}
+	}
+}
+
+func TestMermaidExporter_GanttSectionTag(t *testing.T) {
+	tr := parallelTrace()
+	tr.Spans[0].Tags = map[string]string{"component": "db"}
+	tr.Spans[1].Tags = map[string]string{"component": "http"}
+	tr.Spans[2].Tags = map[string]string{"component": "db"}
+	diagram, err := RenderMermaid(tr, MermaidOptions{Mode: Gantt, SectionTag: "component"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := string(diagram)
+
+	sections := []string{}
+	for _, line := range strings.Split(logs, "\n") {
+		if name, ok := strings.CutPrefix(line, "    section "); ok {
+			sections = append(sections, name)
+		}
+	}
+	if strings.Join(sections, ",") != "other,db,http" {
+		t.Errorf("unexpected sections %v in:\n%s", sections, logs)
+	}
+	if !strings.Contains(logs, "section db\n    Load Order (40ms) :N53995c3f42cd8ad8, 10, 50\n    Render (30ms)") {
+		t.Errorf("expected both db spans in one section:\n%s", logs)
+	}
+}
+
+func TestRenderMermaid_GanttScale(t *testing.T) {
+	// Sub-millisecond spans still get a bar
+	tr := parallelTrace()
+	render := tr.Spans[2]
+	render.EndTime = render.StartTime.Add(300 * time.Microsecond)
+	render.Duration = 0
+	diagram, err := RenderMermaid(tr, MermaidOptions{Mode: Gantt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(diagram), "    Render (<1ms) :Ne457b5a2e4d86bd1, 60, 61\n") {
+		t.Errorf("expected a one millisecond bar:\n%s", diagram)
+	}
+
+	// Traces of a minute or more use wall clock times, the seconds axis would wrap
+	tr = parallelTrace()
+	tr.Root.EndTime = tr.Root.StartTime.Add(90 * time.Second)
+	tr.Root.Duration = 90000
+	diagram, err = RenderMermaid(tr, MermaidOptions{Mode: Gantt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := tr.Root.StartTime.UnixMilli()
+	want := fmt.Sprintf("    GET /orders (90000ms) :N00f067aa0ba902b7, %d, %d\n", start, start+90000)
+	if !strings.Contains(string(diagram), "    axisFormat %H:%M:%S\n") || !strings.Contains(string(diagram), want) {
+		t.Errorf("expected a wall clock axis:\n%s", diagram)
+	}
+}
+
+func TestMermaidExporter_Sequence(t *testing.T) {
+	tr := parallelTrace()
+	tr.Resource = &flowtracker.Resource{ServiceName: "orders"}
+	tr.Spans[0].Name = "DB: Select Order"
+	tr.Spans[1].Tags = map[string]string{"peer.service": "customers"}
+	tr.Spans[2].ParentID = tr.Spans[1].ID
+	tr.Spans[2].StartTime, tr.Spans[2].EndTime = tr.Spans[1].StartTime.Add(10*time.Millisecond), tr.Spans[1].EndTime
+	var buf bytes.Buffer
+	(&MermaidExporter{Mode: Sequence, ParticipantTag: "peer.service", Writer: &buf}).Export(tr)
+	logs := buf.String()
+
+	expected := []string{
+		"```mermaid",
+		"sequenceDiagram",
+		"    participant P0 as Client",
+		"    participant P1 as orders",
+		"    participant P2 as DB",
+		"    participant P3 as customers",
+		"    P0->>P1: GET /orders",
+		"    P1->>P2: Select Order",
+		"    P1->>P3: Load Customer",
+		"    P3->>P3: Render",
+		"    P2-->>P1: 40ms",
+		"    P3-->>P3: 30ms",
+		"    P3-->>P1: 40ms",
+		"    P1-->>P0: 100ms",
+		"```",
+	}
+	lines := strings.Split(logs, "\n")[2:]
+	for i, want := range expected {
+		if i >= len(lines) || lines[i] != want {
+			t.Fatalf("line %d: expected %q, got:\n%s", i, want, logs)
+		}
+	}
+}
+
+func TestRenderMermaid(t *testing.T) {
+	diagram, err := RenderMermaid(parallelTrace(), MermaidOptions{Orientation: LeftRight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(diagram), "graph LR\n    N00f067aa0ba902b7[\"GET /orders\"] -->|40ms| N53995c3f42cd8ad8[\"Load Order\"]\n") {
+		t.Errorf("unexpected diagram:\n%s", diagram)
+	}
+
+	if _, err := RenderMermaid(parallelTrace(), MermaidOptions{Mode: "pie"}); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+	if _, err := RenderMermaid(nil, MermaidOptions{}); err == nil {
+		t.Error("expected an error for a nil trace")
+	}
+}
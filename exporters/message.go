@@ -0,0 +1,290 @@
+package exporters
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// Message headers set on every message encoded by MessageEncoder.
+const (
+	// HeaderServiceName carries the service name of the trace's resource, if known.
+	HeaderServiceName = "service.name"
+	// HeaderSchemaVersion carries SchemaVersion, so consumers can handle format changes.
+	HeaderSchemaVersion = "flowtracker.schema.version"
+	// HeaderContentType is ContentTypeTrace or ContentTypeSpan.
+	HeaderContentType = "content-type"
+	// HeaderChunk is set to "<n>/<total>" on the messages of a trace split with OversizeSplit.
+	HeaderChunk = "flowtracker.chunk"
+)
+
+const (
+	// SchemaVersion is the version of the JSON payload.
+	SchemaVersion = "1"
+	// ContentTypeTrace is the content type of a message holding a whole trace (or a chunk of it).
+	ContentTypeTrace = "application/vnd.flowtracker.trace+json"
+	// ContentTypeSpan is the content type of a message holding a single SpanMessage.
+	ContentTypeSpan = "application/vnd.flowtracker.span+json"
+)
+
+// TruncatedAttribute is the trace attribute holding the number of spans removed by OversizeTruncate.
+const TruncatedAttribute = "flowtracker.truncated_spans"
+
+// DefaultMaxMessageBytes stays below Kafka's default message.max.bytes (1048588),
+// leaving room for the key and headers.
+const DefaultMaxMessageBytes = 1000000
+
+// ErrMessageTooLarge is wrapped by the errors returned for dropped payloads.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// OversizeStrategy decides what happens to a trace whose payload exceeds MaxMessageBytes.
+type OversizeStrategy int
+
+const (
+	// OversizeDrop drops the trace and counts it in Dropped (default).
+	OversizeDrop OversizeStrategy = iota
+	// OversizeTruncate keeps the earliest spans that fit, and records how many were removed
+	// in the TruncatedAttribute trace attribute.
+	OversizeTruncate
+	// OversizeSplit sends the spans in several messages with the same key,
+	// numbered with the HeaderChunk header.
+	OversizeSplit
+)
+
+// SpanMessage is the payload of a message in SpanPerMessage mode:
+// the span's own fields plus the trace it belongs to.
+type SpanMessage struct {
+	TraceID    string                `json:"trace_id"`
+	Attributes map[string]string     `json:"attributes,omitempty"`
+	Resource   *flowtracker.Resource `json:"resource,omitempty"`
+	*flowtracker.Span
+}
+
+// Message is an encoded message, ready to be sent by a message broker client.
+type Message struct {
+	Key     []byte
+	Value   []byte
+	Headers []MessageHeader
+}
+
+// MessageHeader is a header of a Message.
+type MessageHeader struct {
+	Key   string
+	Value []byte
+}
+
+// MessageEncoder turns traces into JSON messages for message brokers such as Kafka.
+// It chooses the key, sets the headers and keeps every payload within MaxMessageBytes,
+// so broker exporters only have to send the messages. It is safe for concurrent use.
+type MessageEncoder struct {
+	// KeyAttribute names a trace attribute (see flowtracker.SetTraceAttr) used as the message key,
+	// e.g. "tenant" to keep all traces of a tenant on the same partition.
+	// Falls back to the TraceID when empty or when the trace doesn't carry the attribute.
+	KeyAttribute string
+
+	// HeaderAttributes lists trace attributes copied into the message headers,
+	// so consumers can filter without decoding the payload.
+	HeaderAttributes []string
+
+	// MaxMessageBytes limits the size of a message payload. Default: DefaultMaxMessageBytes
+	MaxMessageBytes int
+
+	// Oversize is applied to traces whose payload exceeds MaxMessageBytes. Default: OversizeDrop
+	Oversize OversizeStrategy
+
+	// SpanPerMessage encodes one SpanMessage per span instead of one message per trace.
+	// All spans of a trace share the same key. A span that doesn't fit MaxMessageBytes is dropped.
+	SpanPerMessage bool
+
+	dropped atomic.Uint64
+}
+
+// Dropped returns the number of traces, or single spans in SpanPerMessage and OversizeSplit mode,
+// dropped because they exceeded MaxMessageBytes.
+func (e *MessageEncoder) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+// Encode returns the messages of the trace. All messages of a trace share the same key.
+// The error reports the payloads that were dropped, the messages returned with it must
+// still be sent.
+func (e *MessageEncoder) Encode(tr *flowtracker.Trace) ([]Message, error) {
+	if tr == nil {
+		return nil, errNilTrace
+	}
+	// We use the TraceID as the Key by default. This ensures that all messages of
+	// a trace (chunks or spans) go to the same partition.
+	key := tr.TraceID
+	if e.KeyAttribute != "" {
+		if v, ok := tr.Attr(e.KeyAttribute); ok && v != "" {
+			key = v
+		}
+	}
+
+	if e.SpanPerMessage {
+		return e.encodeSpans(tr, key)
+	}
+
+	// Serialize Trace to JSON
+	payload, err := json.Marshal(tr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal trace: %w", err)
+	}
+	if len(payload) <= e.maxBytes() {
+		return []Message{e.message(tr, key, payload, ContentTypeTrace)}, nil
+	}
+
+	switch e.Oversize {
+	case OversizeTruncate:
+		if payload, ok := e.truncate(tr); ok {
+			return []Message{e.message(tr, key, payload, ContentTypeTrace)}, nil
+		}
+	case OversizeSplit:
+		chunks, err := e.split(tr)
+		if len(chunks) == 0 {
+			return nil, errors.Join(err, e.drop(fmt.Sprintf("trace %s", tr.TraceID), len(payload)))
+		}
+		msgs := make([]Message, len(chunks))
+		for i, payload := range chunks {
+			msgs[i] = e.message(tr, key, payload, ContentTypeTrace,
+				MessageHeader{Key: HeaderChunk, Value: []byte(strconv.Itoa(i+1) + "/" + strconv.Itoa(len(chunks)))})
+		}
+		return msgs, err
+	}
+	return nil, e.drop(fmt.Sprintf("trace %s", tr.TraceID), len(payload))
+}
+
+// encodeSpans returns one SpanMessage per span.
+func (e *MessageEncoder) encodeSpans(tr *flowtracker.Trace, key string) ([]Message, error) {
+	var msgs []Message
+	var errs []error
+	for _, s := range tr.Spans {
+		payload, err := json.Marshal(SpanMessage{TraceID: tr.TraceID, Attributes: tr.Attributes, Resource: tr.Resource, Span: s})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to marshal span: %w", err))
+			continue
+		}
+		if len(payload) > e.maxBytes() {
+			errs = append(errs, e.drop(fmt.Sprintf("span %s of trace %s", s.ID, tr.TraceID), len(payload)))
+			continue
+		}
+		msgs = append(msgs, e.message(tr, key, payload, ContentTypeSpan))
+	}
+	return msgs, errors.Join(errs...)
+}
+
+// truncate returns the payload of tr with as many of its earliest spans as fit.
+func (e *MessageEncoder) truncate(tr *flowtracker.Trace) ([]byte, bool) {
+	attrs := make(map[string]string, len(tr.Attributes)+1)
+	for key, v := range tr.Attributes {
+		attrs[key] = v
+	}
+	marshal := func(n int) []byte {
+		attrs[TruncatedAttribute] = strconv.Itoa(len(tr.Spans) - n)
+		payload, _ := json.Marshal(subTrace(tr, tr.Spans[:n], attrs))
+		return payload
+	}
+
+	// Binary search for the largest prefix of spans that fits
+	lo, hi := 0, len(tr.Spans)-1
+	var best []byte
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		if payload := marshal(mid); len(payload) <= e.maxBytes() {
+			best, lo = payload, mid+1
+		} else {
+			hi = mid - 1
+		}
+	}
+	return best, best != nil
+}
+
+// split distributes the spans of tr over as few payloads as possible that each fit.
+// Spans too large for a message on their own are dropped.
+func (e *MessageEncoder) split(tr *flowtracker.Trace) ([][]byte, error) {
+	empty, err := json.Marshal(subTrace(tr, []*flowtracker.Span{}, tr.Attributes))
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks [][]byte
+	var errs []error
+	var current []*flowtracker.Span
+	size := len(empty)
+	flush := func() {
+		if len(current) > 0 {
+			payload, _ := json.Marshal(subTrace(tr, current, tr.Attributes))
+			chunks = append(chunks, payload)
+		}
+		current, size = nil, len(empty)
+	}
+	for _, s := range tr.Spans {
+		b, err := json.Marshal(s)
+		if err != nil {
+			continue
+		}
+		if len(empty)+len(b) > e.maxBytes() {
+			errs = append(errs, e.drop(fmt.Sprintf("span %s of trace %s", s.ID, tr.TraceID), len(empty)+len(b)))
+			continue
+		}
+		// One byte for the separating comma
+		if size+len(b)+1 > e.maxBytes() {
+			flush()
+		}
+		current = append(current, s)
+		size += len(b) + 1
+	}
+	flush()
+	return chunks, errors.Join(errs...)
+}
+
+// subTrace returns a copy of tr holding only spans, for encoding.
+func subTrace(tr *flowtracker.Trace, spans []*flowtracker.Span, attrs map[string]string) *flowtracker.Trace {
+	return &flowtracker.Trace{
+		TraceID:        tr.TraceID,
+		RemoteParentID: tr.RemoteParentID,
+		Root:           tr.Root,
+		Spans:          spans,
+		Attributes:     attrs,
+		Resource:       tr.Resource,
+	}
+}
+
+// message wraps payload with the standard and configured headers.
+func (e *MessageEncoder) message(tr *flowtracker.Trace, key string, payload []byte, contentType string, extra ...MessageHeader) Message {
+	msg := Message{
+		Key:   []byte(key),
+		Value: payload,
+		Headers: []MessageHeader{
+			{Key: HeaderSchemaVersion, Value: []byte(SchemaVersion)},
+			{Key: HeaderContentType, Value: []byte(contentType)},
+		},
+	}
+	if tr.Resource != nil && tr.Resource.ServiceName != "" {
+		msg.Headers = append(msg.Headers, MessageHeader{Key: HeaderServiceName, Value: []byte(tr.Resource.ServiceName)})
+	}
+	msg.Headers = append(msg.Headers, extra...)
+	for _, name := range e.HeaderAttributes {
+		if v, ok := tr.Attr(name); ok {
+			msg.Headers = append(msg.Headers, MessageHeader{Key: name, Value: []byte(v)})
+		}
+	}
+	return msg
+}
+
+// drop counts a payload that exceeded MaxMessageBytes.
+func (e *MessageEncoder) drop(what string, size int) error {
+	e.dropped.Add(1)
+	return fmt.Errorf("dropped %s: %w (%d > %d bytes)", what, ErrMessageTooLarge, size, e.maxBytes())
+}
+
+func (e *MessageEncoder) maxBytes() int {
+	if e.MaxMessageBytes <= 0 {
+		return DefaultMaxMessageBytes
+	}
+	return e.MaxMessageBytes
+}
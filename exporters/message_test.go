@@ -0,0 +1,169 @@
+package exporters
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// checkoutTrace is a trace of the "checkout" service with n child spans,
+// each carrying a tag of tagSize bytes.
+func checkoutTrace(n, tagSize int) *flowtracker.Trace {
+	start := time.Unix(1700000000, 0)
+	root := &flowtracker.Span{ID: "00f067aa0ba902b7", Name: "GET /checkout", StartTime: start, EndTime: start.Add(time.Second), Duration: 1000}
+	tr := &flowtracker.Trace{
+		TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		Root:       root,
+		Spans:      []*flowtracker.Span{root},
+		Attributes: map[string]string{"tenant": "acme"},
+		Resource:   &flowtracker.Resource{ServiceName: "checkout"},
+	}
+	for i := 0; i < n; i++ {
+		tr.Spans = append(tr.Spans, &flowtracker.Span{
+			ID: fmt.Sprintf("%016x", i+1), ParentID: root.ID, Name: "step " + strconv.Itoa(i),
+			StartTime: start, EndTime: start.Add(time.Millisecond), Duration: 1,
+			Tags: map[string]string{"payload": strings.Repeat("x", tagSize)},
+		})
+	}
+	return tr
+}
+
+func messageHeader(msg Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestMessageEncoder_Headers(t *testing.T) {
+	tr := checkoutTrace(2, 10)
+	msgs, err := (&MessageEncoder{HeaderAttributes: []string{"tenant", "missing"}}).Encode(tr)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("expected one message, got %d (err %v)", len(msgs), err)
+	}
+	msg := msgs[0]
+	if string(msg.Key) != tr.TraceID {
+		t.Errorf("expected the trace ID as key, got %s", msg.Key)
+	}
+	want := map[string]string{
+		HeaderServiceName:   "checkout",
+		HeaderSchemaVersion: SchemaVersion,
+		HeaderContentType:   ContentTypeTrace,
+		"tenant":            "acme",
+	}
+	for k, v := range want {
+		if got := messageHeader(msg, k); got != v {
+			t.Errorf("expected header %s=%q, got %q", k, v, got)
+		}
+	}
+	if len(msg.Headers) != len(want) {
+		t.Errorf("unexpected headers: %v", msg.Headers)
+	}
+	var got flowtracker.Trace
+	if err := json.Unmarshal(msg.Value, &got); err != nil || got.TraceID != tr.TraceID || len(got.Spans) != 3 {
+		t.Errorf("unexpected payload %s (err %v)", msg.Value, err)
+	}
+}
+
+func TestMessageEncoder_OversizeDrop(t *testing.T) {
+	enc := &MessageEncoder{MaxMessageBytes: 1000}
+	msgs, err := enc.Encode(checkoutTrace(5, 500))
+	if len(msgs) != 0 || !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("expected ErrMessageTooLarge and no messages, got %d messages and %v", len(msgs), err)
+	}
+	if enc.Dropped() != 1 {
+		t.Errorf("expected 1 dropped trace, got %d", enc.Dropped())
+	}
+
+	// Traces that fit are still encoded
+	if msgs, err := enc.Encode(checkoutTrace(1, 10)); err != nil || len(msgs) != 1 {
+		t.Errorf("expected one message, got %d (err %v)", len(msgs), err)
+	}
+}
+
+func TestMessageEncoder_OversizeTruncate(t *testing.T) {
+	tr := checkoutTrace(5, 500)
+	msgs, err := (&MessageEncoder{MaxMessageBytes: 1500, Oversize: OversizeTruncate}).Encode(tr)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("expected one message, got %d (err %v)", len(msgs), err)
+	}
+	if len(msgs[0].Value) > 1500 {
+		t.Errorf("payload exceeds the limit: %d bytes", len(msgs[0].Value))
+	}
+	var got flowtracker.Trace
+	if err := json.Unmarshal(msgs[0].Value, &got); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if got.Spans[0].ID != tr.Root.ID || len(got.Spans) == len(tr.Spans) {
+		t.Errorf("expected the earliest spans to be kept, got %d spans", len(got.Spans))
+	}
+	if got.Attributes[TruncatedAttribute] != strconv.Itoa(len(tr.Spans)-len(got.Spans)) || got.Attributes["tenant"] != "acme" {
+		t.Errorf("unexpected attributes: %v", got.Attributes)
+	}
+	if _, ok := tr.Attr(TruncatedAttribute); ok {
+		t.Error("the encoded trace must not be modified")
+	}
+}
+
+func TestMessageEncoder_OversizeSplit(t *testing.T) {
+	tr := checkoutTrace(5, 500)
+	tr.Spans[3].Tags["payload"] = strings.Repeat("x", 2000)
+	enc := &MessageEncoder{MaxMessageBytes: 1500, Oversize: OversizeSplit}
+	msgs, err := enc.Encode(tr)
+
+	// The span too large for a message of its own is dropped, the others are sent
+	if !errors.Is(err, ErrMessageTooLarge) || enc.Dropped() != 1 {
+		t.Errorf("expected one dropped span, got %d (err %v)", enc.Dropped(), err)
+	}
+	if len(msgs) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(msgs))
+	}
+	var ids []string
+	for i, msg := range msgs {
+		if len(msg.Value) > 1500 || string(msg.Key) != tr.TraceID {
+			t.Errorf("unexpected chunk: %d bytes, key %s", len(msg.Value), msg.Key)
+		}
+		if got, want := messageHeader(msg, HeaderChunk), fmt.Sprintf("%d/%d", i+1, len(msgs)); got != want {
+			t.Errorf("expected chunk header %q, got %q", want, got)
+		}
+		var got flowtracker.Trace
+		if err := json.Unmarshal(msg.Value, &got); err != nil {
+			t.Fatalf("invalid payload: %v", err)
+		}
+		for _, s := range got.Spans {
+			ids = append(ids, s.ID)
+		}
+	}
+	if len(ids) != len(tr.Spans)-1 {
+		t.Errorf("expected %d spans across the chunks, got %d", len(tr.Spans)-1, len(ids))
+	}
+}
+
+func TestMessageEncoder_SpanPerMessage(t *testing.T) {
+	tr := checkoutTrace(2, 10)
+	msgs, err := (&MessageEncoder{SpanPerMessage: true, KeyAttribute: "tenant"}).Encode(tr)
+	if err != nil || len(msgs) != len(tr.Spans) {
+		t.Fatalf("expected a message per span, got %d (err %v)", len(msgs), err)
+	}
+	for i, msg := range msgs {
+		if string(msg.Key) != "acme" || messageHeader(msg, HeaderContentType) != ContentTypeSpan {
+			t.Errorf("unexpected message: key %s, headers %v", msg.Key, msg.Headers)
+		}
+		var got struct {
+			TraceID    string            `json:"trace_id"`
+			SpanID     string            `json:"span_id"`
+			Attributes map[string]string `json:"attributes"`
+		}
+		if err := json.Unmarshal(msg.Value, &got); err != nil || got.TraceID != tr.TraceID || got.SpanID != tr.Spans[i].ID || got.Attributes["tenant"] != "acme" {
+			t.Errorf("unexpected payload %s (err %v)", msg.Value, err)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package exporters
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// OTLPExporter sends traces over OTLP/HTTP to an OpenTelemetry Collector, Grafana Tempo,
+// Jaeger or any other OTLP receiver, without the OTel SDK.
+//
+// Full batches are queued and sent in the background, so a slow or retrying receiver
+// never holds up Export. Call Flush on shutdown to send the traces still waiting.
+type OTLPExporter struct {
+	// Endpoint is the full URL of the traces endpoint. Default "http://localhost:4318/v1/traces"
+	Endpoint string
+
+	// Headers are added to every request, e.g. {"Authorization": "Bearer <token>"}
+	Headers map[string]string
+
+	// Protobuf sends application/x-protobuf instead of the default application/json
+	Protobuf bool
+
+	// Gzip compresses the request body
+	Gzip bool
+
+	// BatchSize is the number of traces sent in one request. Default 1 (no batching)
+	BatchSize int
+
+	// BatchTimeout sends an incomplete batch once its first trace waited this long. Default 5s
+	BatchTimeout time.Duration
+
+	// MaxRetries is the number of retries after a network error or a 429, 502, 503 or 504
+	// response. Default 3, a negative value disables retries.
+	MaxRetries int
+
+	// RetryBackoff is the wait before the first retry, doubled for every further retry.
+	// A Retry-After response header takes precedence. Default 1s
+	RetryBackoff time.Duration
+
+	// Client sends the requests. Default: an http.Client with a 10s timeout
+	Client *http.Client
+
+	// QueueSize is the number of batches waiting to be sent. Once it is reached, further
+	// batches are dropped and reported to OnError. Default 16
+	QueueSize int
+
+	// OnError is called when a batch could not be delivered. Default: prints the error
+	OnError func(err error)
+
+	batcher traceBatcher
+
+	mu      sync.Mutex
+	queue   []otlpQueued
+	sending bool
+}
+
+// otlpQueued is a batch waiting to be sent. done is closed once it was handled.
+type otlpQueued struct {
+	batch []*flowtracker.Trace
+	done  chan struct{}
+}
+
+// Export adds the trace to the current batch and queues the batch once it is full.
+func (e *OTLPExporter) Export(tr *flowtracker.Trace) {
+	if batch := e.batcher.add(tr, e.BatchSize, e.BatchTimeout, e.flushAsync); batch != nil {
+		e.enqueue(otlpQueued{batch: batch})
+	}
+}
+
+// Flush sends the traces waiting in the current batch, and returns once all queued
+// batches were sent or given up on.
+func (e *OTLPExporter) Flush() {
+	done := make(chan struct{})
+	e.enqueue(otlpQueued{batch: e.batcher.take(), done: done})
+	<-done
+}
+
+// flushAsync queues the current batch once BatchTimeout expired.
+func (e *OTLPExporter) flushAsync() {
+	if batch := e.batcher.take(); len(batch) > 0 {
+		e.enqueue(otlpQueued{batch: batch})
+	}
+}
+
+// enqueue hands the batch to the sending goroutine, started if none is running.
+// Batches beyond QueueSize are dropped, Flush requests always wait their turn.
+func (e *OTLPExporter) enqueue(q otlpQueued) {
+	size := e.QueueSize
+	if size <= 0 {
+		size = 16
+	}
+	e.mu.Lock()
+	if q.done == nil && len(e.queue) >= size {
+		e.mu.Unlock()
+		e.error(fmt.Errorf("otlp: send queue full, dropped %d traces", len(q.batch)))
+		return
+	}
+	e.queue = append(e.queue, q)
+	if !e.sending {
+		e.sending = true
+		go e.sendQueued()
+	}
+	e.mu.Unlock()
+}
+
+// sendQueued sends the queued batches in order, and exits once the queue is empty.
+func (e *OTLPExporter) sendQueued() {
+	for {
+		e.mu.Lock()
+		if len(e.queue) == 0 {
+			e.sending = false
+			e.mu.Unlock()
+			return
+		}
+		q := e.queue[0]
+		e.queue = e.queue[1:]
+		e.mu.Unlock()
+
+		if len(q.batch) > 0 {
+			e.send(q.batch)
+		}
+		if q.done != nil {
+			close(q.done)
+		}
+	}
+}
+
+func (e *OTLPExporter) send(batch []*flowtracker.Trace) {
+	req := newOTLPRequest(batch)
+	var body []byte
+	var err error
+	contentType := "application/json"
+	if e.Protobuf {
+		body, contentType = req.marshalProto(), "application/x-protobuf"
+	} else if body, err = json.Marshal(req); err != nil {
+		e.error(fmt.Errorf("otlp: failed to encode traces: %w", err))
+		return
+	}
+
+	if e.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		zw.Close()
+		body = buf.Bytes()
+	}
+
+	retries := e.MaxRetries
+	if retries == 0 {
+		retries = 3
+	}
+	backoff := e.RetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for attempt := 0; ; attempt++ {
+		wait, err := e.post(body, contentType)
+		if err == nil {
+			return
+		}
+		if wait < 0 || attempt >= retries {
+			e.error(fmt.Errorf("otlp: failed to send %d traces: %w", len(batch), err))
+			return
+		}
+		if wait == 0 {
+			wait = backoff
+		}
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+// errRetryable marks responses worth sending again.
+var errRetryable = errors.New("retryable")
+
+// post sends one request. On failure it returns the wait before the next attempt:
+// 0 for the default backoff, a positive Retry-After value, or -1 if retrying is pointless.
+func (e *OTLPExporter) post(body []byte, contentType string) (time.Duration, error) {
+	endpoint := e.Endpoint
+	if endpoint == "" {
+		endpoint = "http://localhost:4318/v1/traces"
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable, resp.StatusCode == http.StatusGatewayTimeout:
+		var wait time.Duration
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+			wait = time.Duration(s) * time.Second
+		}
+		return wait, fmt.Errorf("%w: %s", errRetryable, resp.Status)
+	default:
+		return -1, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+}
+
+func (e *OTLPExporter) error(err error) {
+	if e.OnError != nil {
+		e.OnError(err)
+		return
+	}
+	fmt.Printf("FlowTracker OTLP Error: %v\n", err)
+}
+
+// ---------------------------------------------------------
+// OTLP data model (opentelemetry/proto/trace/v1)
+// ---------------------------------------------------------
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano uint64         `json:"startTimeUnixNano,string"`
+	EndTimeUnixNano   uint64         `json:"endTimeUnixNano,string"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Links             []otlpLink     `json:"links,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano uint64         `json:"timeUnixNano,string"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+// otlpAnyValue holds exactly one value. Int64 values are encoded as JSON strings, as the spec requires.
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// OTLP enum values
+const (
+	otlpStatusError = 2
+)
+
+var otlpKinds = map[flowtracker.SpanKind]int{
+	"":                           1,
+	flowtracker.SpanKindInternal: 1,
+	flowtracker.SpanKindServer:   2,
+	flowtracker.SpanKindClient:   3,
+	flowtracker.SpanKindProducer: 4,
+	flowtracker.SpanKindConsumer: 5,
+}
+
+// newOTLPRequest converts traces into one request, grouping them by resource.
+func newOTLPRequest(traces []*flowtracker.Trace) *otlpRequest {
+	req := &otlpRequest{}
+	byResource := make(map[string]int)
+	for _, tr := range traces {
+		key, _ := json.Marshal(tr.Resource)
+		i, ok := byResource[string(key)]
+		if !ok {
+			i = len(req.ResourceSpans)
+			byResource[string(key)] = i
+			req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+				Resource:   otlpResource{Attributes: resourceAttributes(tr.Resource)},
+				ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/spdeepak/flowtracker"}}},
+			})
+		}
+		scope := &req.ResourceSpans[i].ScopeSpans[0]
+		for _, s := range tr.Spans {
+			scope.Spans = append(scope.Spans, newOTLPSpan(tr, s))
+		}
+	}
+	return req
+}
+
+func newOTLPSpan(tr *flowtracker.Trace, s *flowtracker.Span) otlpSpan {
+	span := otlpSpan{
+		TraceID:           tr.TraceID,
+		SpanID:            s.ID,
+		ParentSpanID:      s.ParentID,
+		Name:              s.Name,
+		Kind:              otlpKinds[s.Kind],
+		StartTimeUnixNano: uint64(s.StartTime.UnixNano()),
+		EndTimeUnixNano:   uint64(s.EndTime.UnixNano()),
+	}
+	if s == tr.Root {
+		span.ParentSpanID = tr.RemoteParentID
+		// Trace attributes describe the whole request, the root span is their closest match
+		span.Attributes = otlpAttributes(tr.Attributes, nil)
+	}
+	span.Attributes = append(span.Attributes, otlpAttributes(s.Tags, s.TagTypes)...)
+	if span.Kind == 0 {
+		span.Kind = 1
+	}
+	for _, ev := range s.Events {
+		span.Events = append(span.Events, otlpEvent{
+			TimeUnixNano: uint64(ev.Time.UnixNano()),
+			Name:         ev.Name,
+			Attributes:   otlpAttributes(ev.Attributes, nil),
+		})
+	}
+	for _, l := range s.Links {
+		span.Links = append(span.Links, otlpLink{TraceID: l.TraceID, SpanID: l.SpanID})
+	}
+	if s.Tags["error"] == "true" {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: s.Tags["error.message"]}
+	}
+	return span
+}
+
+func resourceAttributes(r *flowtracker.Resource) []otlpKeyValue {
+	if r == nil {
+		return nil
+	}
+	attrs := otlpAttributes(r.Attributes, nil)
+	for _, kv := range []struct{ key, value string }{
+		{"service.name", r.ServiceName},
+		{"service.version", r.ServiceVersion},
+		{"deployment.environment.name", r.Environment},
+		{"host.name", r.Host},
+		{"k8s.pod.name", r.Pod},
+	} {
+		if kv.value != "" {
+			v := kv.value
+			attrs = append(attrs, otlpKeyValue{Key: kv.key, Value: otlpAnyValue{StringValue: &v}})
+		}
+	}
+	return attrs
+}
+
+// otlpAttributes converts tags to attributes sorted by key. Tags are strings, unless
+// types records the type they were added with (see flowtracker.AddTagInt).
+func otlpAttributes(tags map[string]string, types map[string]flowtracker.TagType) []otlpKeyValue {
+	if len(tags) == 0 {
+		return nil
+	}
+	attrs := make([]otlpKeyValue, 0, len(tags))
+	for _, k := range sortedKeys(tags) {
+		var value otlpAnyValue
+		switch v := flowtracker.TypedValue(tags[k], types[k]).(type) {
+		case bool:
+			value.BoolValue = &v
+		case int64:
+			i := strconv.FormatInt(v, 10)
+			value.IntValue = &i
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				// Not representable in JSON
+				s := tags[k]
+				value.StringValue = &s
+			} else {
+				value.DoubleValue = &v
+			}
+		default:
+			s := tags[k]
+			value.StringValue = &s
+		}
+		attrs = append(attrs, otlpKeyValue{Key: k, Value: value})
+	}
+	return attrs
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,145 @@
+package exporters
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strconv"
+)
+
+// ---------------------------------------------------------
+// Minimal protobuf encoding of the OTLP model, so the exporter
+// needs no generated code. Field numbers follow
+// opentelemetry/proto/collector/trace/v1/trace_service.proto.
+// ---------------------------------------------------------
+
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+)
+
+type pbBuffer []byte
+
+func (b *pbBuffer) tag(field, wireType int) {
+	*b = binary.AppendUvarint(*b, uint64(field)<<3|uint64(wireType))
+}
+
+func (b *pbBuffer) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, pbVarint)
+	*b = binary.AppendUvarint(*b, v)
+}
+
+func (b *pbBuffer) fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, pbFixed64)
+	*b = binary.LittleEndian.AppendUint64(*b, v)
+}
+
+func (b *pbBuffer) bytes(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	b.tag(field, pbBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *pbBuffer) string(field int, v string) {
+	b.bytes(field, []byte(v))
+}
+
+// hexID writes a hex encoded trace or span ID as raw bytes, invalid IDs are skipped.
+func (b *pbBuffer) hexID(field int, id string) {
+	if raw, err := hex.DecodeString(id); err == nil {
+		b.bytes(field, raw)
+	}
+}
+
+// message writes a nested message, even an empty one.
+func (b *pbBuffer) message(field int, encode func(*pbBuffer)) {
+	var inner pbBuffer
+	encode(&inner)
+	b.tag(field, pbBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(inner)))
+	*b = append(*b, inner...)
+}
+
+func (r *otlpRequest) marshalProto() []byte {
+	var b pbBuffer
+	for _, rs := range r.ResourceSpans {
+		b.message(1, func(b *pbBuffer) {
+			b.message(1, func(b *pbBuffer) { b.keyValues(1, rs.Resource.Attributes) })
+			for _, ss := range rs.ScopeSpans {
+				b.message(2, func(b *pbBuffer) {
+					b.message(1, func(b *pbBuffer) { b.string(1, ss.Scope.Name) })
+					for _, s := range ss.Spans {
+						b.message(2, s.marshalProto)
+					}
+				})
+			}
+		})
+	}
+	return b
+}
+
+func (s otlpSpan) marshalProto(b *pbBuffer) {
+	b.hexID(1, s.TraceID)
+	b.hexID(2, s.SpanID)
+	b.hexID(4, s.ParentSpanID)
+	b.string(5, s.Name)
+	b.varint(6, uint64(s.Kind))
+	b.fixed64(7, s.StartTimeUnixNano)
+	b.fixed64(8, s.EndTimeUnixNano)
+	b.keyValues(9, s.Attributes)
+	for _, ev := range s.Events {
+		b.message(11, func(b *pbBuffer) {
+			b.fixed64(1, ev.TimeUnixNano)
+			b.string(2, ev.Name)
+			b.keyValues(3, ev.Attributes)
+		})
+	}
+	for _, l := range s.Links {
+		b.message(13, func(b *pbBuffer) {
+			b.hexID(1, l.TraceID)
+			b.hexID(2, l.SpanID)
+		})
+	}
+	b.message(15, func(b *pbBuffer) {
+		b.string(2, s.Status.Message)
+		b.varint(3, uint64(s.Status.Code))
+	})
+}
+
+func (b *pbBuffer) keyValues(field int, kvs []otlpKeyValue) {
+	for _, kv := range kvs {
+		b.message(field, func(b *pbBuffer) {
+			b.string(1, kv.Key)
+			b.message(2, func(b *pbBuffer) {
+				v := kv.Value
+				switch {
+				case v.BoolValue != nil:
+					// Written even when false: the field marks which value is set
+					b.tag(2, pbVarint)
+					*b = binary.AppendUvarint(*b, map[bool]uint64{false: 0, true: 1}[*v.BoolValue])
+				case v.IntValue != nil:
+					i, _ := strconv.ParseInt(*v.IntValue, 10, 64)
+					b.tag(3, pbVarint)
+					*b = binary.AppendUvarint(*b, uint64(i))
+				case v.DoubleValue != nil:
+					b.tag(4, pbFixed64)
+					*b = binary.LittleEndian.AppendUint64(*b, math.Float64bits(*v.DoubleValue))
+				case v.StringValue != nil:
+					b.tag(1, pbBytes)
+					*b = binary.AppendUvarint(*b, uint64(len(*v.StringValue)))
+					*b = append(*b, *v.StringValue...)
+				}
+			})
+		})
+	}
+}
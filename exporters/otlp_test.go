@@ -0,0 +1,289 @@
+package exporters
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// otlpReceiver records the bodies posted to it, after answering the first requests
+// with the given status codes.
+type otlpReceiver struct {
+	mu       sync.Mutex
+	failures []int
+	requests []*http.Request
+	bodies   [][]byte
+	received chan struct{}
+}
+
+func newOTLPReceiver(t *testing.T, failures ...int) (*otlpReceiver, *httptest.Server) {
+	rec := &otlpReceiver{failures: failures, received: make(chan struct{}, 10)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Method != http.MethodPost {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("invalid gzip body: %v", err)
+				return
+			}
+			body = zr
+		}
+		b, _ := io.ReadAll(body)
+
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.requests = append(rec.requests, r)
+		if len(rec.failures) > 0 {
+			w.WriteHeader(rec.failures[0])
+			rec.failures = rec.failures[1:]
+			return
+		}
+		rec.bodies = append(rec.bodies, b)
+		rec.received <- struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+	return rec, srv
+}
+
+func (rec *otlpReceiver) next(t *testing.T) []byte {
+	t.Helper()
+	select {
+	case <-rec.received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an OTLP request")
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.bodies[len(rec.bodies)-1]
+}
+
+func TestOTLPExporter_JSON(t *testing.T) {
+	rec, srv := newOTLPReceiver(t)
+	exp := &OTLPExporter{
+		Endpoint: srv.URL + "/v1/traces",
+		Headers:  map[string]string{"Authorization": "Bearer secret"},
+		Gzip:     true,
+	}
+	exp.Export(otlpTestTrace("4bf92f3577b34da6a3ce929d0e0e4736"))
+
+	var req otlpRequest
+	if err := json.Unmarshal(rec.next(t), &req); err != nil {
+		t.Fatalf("invalid JSON payload: %v", err)
+	}
+	r := rec.requests[0]
+	if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("unexpected headers: %v", r.Header)
+	}
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected payload: %+v", req)
+	}
+	resource := attrMap(req.ResourceSpans[0].Resource.Attributes)
+	if resource["service.name"] != "orders" || resource["deployment.environment.name"] != "prod" {
+		t.Errorf("unexpected resource: %v", resource)
+	}
+
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	root, child := spans[0], spans[1]
+	if root.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || root.ParentSpanID != "b9c7c989f97918e1" || root.Kind != 2 {
+		t.Errorf("unexpected root span: %+v", root)
+	}
+	if root.Status.Code != otlpStatusError || root.Status.Message != "boom" {
+		t.Errorf("unexpected status: %+v", root.Status)
+	}
+	// Trace attributes and untyped tags stay strings, even if they look like numbers
+	if attrMap(root.Attributes)["user.id"] != "42" {
+		t.Errorf("expected the trace attributes on the root span, got %v", attrMap(root.Attributes))
+	}
+	if child.ParentSpanID != root.SpanID || child.Kind != 3 || child.EndTimeUnixNano-child.StartTimeUnixNano != uint64(19*time.Millisecond) {
+		t.Errorf("unexpected child span: %+v", child)
+	}
+	want := map[string]string{"db.rows": "int:3", "cache.hit": "bool:false", "ratio": "double:0.5", "db.system": "postgres", "order.id": "12345"}
+	got := attrMap(child.Attributes)
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("expected attribute %s=%s, got %s", k, v, got[k])
+		}
+	}
+	if len(child.Events) != 1 || child.Events[0].Name != "retry" || len(child.Links) != 1 || child.Links[0].SpanID != "b7ad6b7169203331" {
+		t.Errorf("unexpected events or links: %+v, %+v", child.Events, child.Links)
+	}
+}
+
+// attrMap flattens attributes to "type:value" strings, plain strings stay as they are.
+func attrMap(kvs []otlpKeyValue) map[string]string {
+	out := make(map[string]string)
+	for _, kv := range kvs {
+		v := kv.Value
+		switch {
+		case v.BoolValue != nil:
+			out[kv.Key] = map[bool]string{true: "bool:true", false: "bool:false"}[*v.BoolValue]
+		case v.IntValue != nil:
+			out[kv.Key] = "int:" + *v.IntValue
+		case v.DoubleValue != nil:
+			b, _ := json.Marshal(*v.DoubleValue)
+			out[kv.Key] = "double:" + string(b)
+		case v.StringValue != nil:
+			out[kv.Key] = *v.StringValue
+		}
+	}
+	return out
+}
+
+func TestOTLPExporter_Protobuf(t *testing.T) {
+	rec, srv := newOTLPReceiver(t)
+	exp := &OTLPExporter{Endpoint: srv.URL + "/v1/traces", Protobuf: true}
+	exp.Export(otlpTestTrace("4bf92f3577b34da6a3ce929d0e0e4736"))
+
+	body := rec.next(t)
+	if ct := rec.requests[0].Header.Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	resourceSpans := pbFields(t, body)[1]
+	if len(resourceSpans) != 1 {
+		t.Fatalf("expected 1 resource spans, got %d", len(resourceSpans))
+	}
+	scopeSpans := pbFields(t, resourceSpans[0])[2]
+	spans := pbFields(t, scopeSpans[0])[2]
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	root := pbFields(t, spans[0])
+	if hex.EncodeToString(root[1][0]) != "4bf92f3577b34da6a3ce929d0e0e4736" || string(root[5][0]) != "GET /orders" {
+		t.Errorf("unexpected root span: trace %x, name %q", root[1][0], root[5][0])
+	}
+	if hex.EncodeToString(root[4][0]) != "b9c7c989f97918e1" {
+		t.Errorf("unexpected parent span ID %x", root[4][0])
+	}
+	child := pbFields(t, spans[1])
+	if len(child[9]) != 5 || len(child[11]) != 1 || len(child[13]) != 1 {
+		t.Errorf("expected 5 attributes, 1 event and 1 link, got %d, %d, %d", len(child[9]), len(child[11]), len(child[13]))
+	}
+}
+
+// pbFields decodes one protobuf message into the raw values of its fields.
+// Varint and fixed64 values are returned as their encoded bytes.
+func pbFields(t *testing.T, b []byte) map[int][][]byte {
+	t.Helper()
+	fields := make(map[int][][]byte)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("invalid protobuf tag")
+		}
+		b = b[n:]
+		field, wireType := int(key>>3), key&7
+		var value []byte
+		switch wireType {
+		case pbVarint:
+			_, n = binary.Uvarint(b)
+			value, b = b[:n], b[n:]
+		case pbFixed64:
+			value, b = b[:8], b[8:]
+		case pbBytes:
+			l, n := binary.Uvarint(b)
+			value, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", wireType)
+		}
+		fields[field] = append(fields[field], value)
+	}
+	return fields
+}
+
+func TestOTLPExporter_Batching(t *testing.T) {
+	rec, srv := newOTLPReceiver(t)
+	exp := &OTLPExporter{Endpoint: srv.URL + "/v1/traces", BatchSize: 2, BatchTimeout: 50 * time.Millisecond}
+
+	exp.Export(otlpTestTrace("4bf92f3577b34da6a3ce929d0e0e4736"))
+	exp.Export(otlpTestTrace("0af7651916cd43dd8448eb211c80319c"))
+	var req otlpRequest
+	json.Unmarshal(rec.next(t), &req)
+	if n := len(req.ResourceSpans[0].ScopeSpans[0].Spans); len(req.ResourceSpans) != 1 || n != 4 {
+		t.Errorf("expected both traces in one request, got %d spans", n)
+	}
+
+	// An incomplete batch is sent after BatchTimeout
+	exp.Export(otlpTestTrace("4bf92f3577b34da6a3ce929d0e0e4736"))
+	json.Unmarshal(rec.next(t), &req)
+	if n := len(req.ResourceSpans[0].ScopeSpans[0].Spans); n != 2 {
+		t.Errorf("expected one trace, got %d spans", n)
+	}
+}
+
+func TestOTLPExporter_Retry(t *testing.T) {
+	rec, srv := newOTLPReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	exp := &OTLPExporter{Endpoint: srv.URL + "/v1/traces", RetryBackoff: time.Millisecond}
+	exp.Export(otlpTestTrace("4bf92f3577b34da6a3ce929d0e0e4736"))
+	rec.next(t)
+	if len(rec.requests) != 3 {
+		t.Errorf("expected 3 attempts, got %d", len(rec.requests))
+	}
+
+	// Client errors are not retried
+	_, srv = newOTLPReceiver(t, http.StatusBadRequest)
+	var gotErr error
+	exp = &OTLPExporter{Endpoint: srv.URL + "/v1/traces", RetryBackoff: time.Millisecond, OnError: func(err error) { gotErr = err }}
+	exp.Export(otlpTestTrace("4bf92f3577b34da6a3ce929d0e0e4736"))
+	exp.Flush()
+	if gotErr == nil || errors.Is(gotErr, errRetryable) {
+		t.Errorf("expected a non-retryable error, got %v", gotErr)
+	}
+}
+
+func TestOTLPExporter_Queue(t *testing.T) {
+	rec, srv := newOTLPReceiver(t, http.StatusServiceUnavailable)
+	errs := make(chan error, 10)
+	exp := &OTLPExporter{
+		Endpoint:     srv.URL + "/v1/traces",
+		RetryBackoff: 300 * time.Millisecond,
+		QueueSize:    1,
+		OnError:      func(err error) { errs <- err },
+	}
+	exp.Export(otlpTestTrace("4bf92f3577b34da6a3ce929d0e0e4736"))
+	for attempts := 0; attempts == 0; {
+		time.Sleep(time.Millisecond)
+		rec.mu.Lock()
+		attempts = len(rec.requests)
+		rec.mu.Unlock()
+	}
+
+	// The first batch waits for its retry in the background, the next one is queued
+	// and the one after it dropped, without blocking Export
+	start := time.Now()
+	exp.Export(otlpTestTrace("0af7651916cd43dd8448eb211c80319c"))
+	exp.Export(otlpTestTrace("b9c7c989f97918e1b9c7c989f97918e1"))
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Export blocked for %v during a retry", d)
+	}
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "queue full") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	default:
+		t.Error("expected the batch beyond QueueSize to be dropped")
+	}
+
+	// Flush waits for the queued batches
+	exp.Flush()
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.bodies) != 2 {
+		t.Errorf("expected 2 delivered batches, got %d", len(rec.bodies))
+	}
+}
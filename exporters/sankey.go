@@ -2,8 +2,10 @@ package exporters
 
 import (
 	"fmt"
+	"io"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/spdeepak/flowtracker"
 )
@@ -20,15 +22,74 @@ type SankeyExporter struct {
 
 	// IncludeAllTags overrides IncludeTags. If true, ALL tags present
 	IncludeAllTags bool
+
+	// Writer receives the output. Default os.Stdout
+	Writer io.Writer
+
+	mu sync.Mutex
+}
+
+// SankeyOptions configures RenderSankey, the fields work like those of SankeyExporter.
+type SankeyOptions struct {
+	IncludeTags    []string
+	IncludeAllTags bool
 }
 
 func (s *SankeyExporter) Export(tr *flowtracker.Trace) {
-	// 1. Map IDs to Names for easy lookup
-	// Note: If multiple spans have the exact same name, they will be grouped
-	// together in the Sankey diagram, which is usually desired behavior.
+	flows, err := RenderSankey(tr, SankeyOptions{IncludeTags: s.IncludeTags, IncludeAllTags: s.IncludeAllTags})
+	if err != nil {
+		fmt.Printf("Error rendering sankey data: %v\n", err)
+		return
+	}
+
+	var sb strings.Builder
+	if !s.CleanOutput {
+		sb.WriteString(fmt.Sprintf("\n----- START SANKEY DATA (trace id: %s)----\n", tr.TraceID))
+	}
+	sb.Write(flows)
+	if !s.CleanOutput {
+		sb.WriteString(fmt.Sprintf("----- END SANKEY DATA (trace id: %s)----\n", tr.TraceID))
+	}
+
+	// Write everything in one atomic operation
+	writeLocked(&s.mu, s.Writer, sb.String())
+}
+
+// RenderSankey returns one "Source [Weight] Target" line per span, the format of SankeyMATIC.
+func RenderSankey(tr *flowtracker.Trace, s SankeyOptions) ([]byte, error) {
+	if tr == nil {
+		return nil, errNilTrace
+	}
+	spanNames := sankeyNames(tr, s)
+
+	// Use strings.Builder to construct the output block
+	var sb strings.Builder
+
+	for _, span := range tr.Spans {
+		if span.ParentID == "" {
+			continue
+		}
+
+		parentName, ok := spanNames[span.ParentID]
+		if !ok {
+			parentName = "Unknown"
+		}
+		currentName := spanNames[span.ID]
+
+		// Format: Source [Weight] Target\n
+		sb.WriteString(fmt.Sprintf("%s [%d] %s\n", parentName, span.Duration, currentName))
+	}
+
+	return []byte(sb.String()), nil
+}
+
+// sankeyNames maps the span IDs to the node names, the span name with the selected tags.
+// Note: If multiple spans have the exact same name, they will be grouped
+// together in the Sankey diagram, which is usually desired behavior.
+func sankeyNames(tr *flowtracker.Trace, s SankeyOptions) map[string]string {
 	spanNames := make(map[string]string)
 
-	// 1. Build names with appended tags
+	// Build names with appended tags
 	for _, span := range tr.Spans {
 		name := span.Name
 
@@ -60,32 +121,5 @@ func (s *SankeyExporter) Export(tr *flowtracker.Trace) {
 		spanNames[span.ID] = name
 	}
 
-	// 2. Use strings.Builder to construct the output block
-	var sb strings.Builder
-
-	if !s.CleanOutput {
-		sb.WriteString(fmt.Sprintf("\n----- START SANKEY DATA (trace id: %s)----\n", tr.TraceID))
-	}
-
-	for _, span := range tr.Spans {
-		if span.ParentID == "" {
-			continue
-		}
-
-		parentName, ok := spanNames[span.ParentID]
-		if !ok {
-			parentName = "Unknown"
-		}
-		currentName := spanNames[span.ID]
-
-		// Format: Source [Weight] Target\n
-		sb.WriteString(fmt.Sprintf("%s [%d] %s\n", parentName, span.Duration, currentName))
-	}
-
-	if !s.CleanOutput {
-		sb.WriteString(fmt.Sprintf("----- END SANKEY DATA (trace id: %s)----\n", tr.TraceID))
-	}
-
-	// 3. Print everything in one atomic operation
-	fmt.Print(sb.String())
+	return spanNames
 }
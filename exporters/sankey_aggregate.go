@@ -0,0 +1,229 @@
+package exporters
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// AggregatedSankeyExporter merges the flows of many traces into one Sankey diagram,
+// showing the steady-state shape of the traffic instead of one block per request.
+// Every parent→child name pair becomes one flow, weighted by the Aggregation of its durations.
+//
+// The diagram is written every Window, after every EveryN traces, or on demand with Flush,
+// and the collected flows start over. Call Close on shutdown to write the last one.
+type AggregatedSankeyExporter struct {
+	// Aggregation combines the durations of a flow: SankeySum, SankeyAvg or SankeyP95. Default SankeySum
+	Aggregation SankeyAggregation
+
+	// Window is the time between two diagrams. Default 1m, unless EveryN is set
+	Window time.Duration
+
+	// EveryN writes the diagram once this many traces were collected.
+	EveryN int
+
+	// GroupByRoot writes a block per root span name, i.e. per route.
+	GroupByRoot bool
+
+	// CleanOutput ensures only the raw data is printed (good for piping)
+	// If false, it adds a header/footer for readability in logs.
+	CleanOutput bool
+
+	// List of tag keys you want to display in the diagram.
+	IncludeTags []string
+
+	// IncludeAllTags overrides IncludeTags. If true, ALL tags present
+	IncludeAllTags bool
+
+	// Writer receives the output. Default os.Stdout
+	Writer io.Writer
+
+	mu     sync.Mutex
+	groups map[string]*sankeyGroup
+	traces int
+	since  time.Time
+	ticker flushTicker
+	// writeMu serializes the writes, so slow output doesn't block Export
+	writeMu sync.Mutex
+}
+
+type SankeyAggregation string
+
+var (
+	// SankeySum adds up the durations, the flow shows the total time spent
+	SankeySum SankeyAggregation = "sum"
+	// SankeyAvg averages the durations per occurrence
+	SankeyAvg SankeyAggregation = "avg"
+	// SankeyP95 takes the 95th percentile of the durations
+	SankeyP95 SankeyAggregation = "p95"
+)
+
+// sankeyGroup holds the flows of one root route, or of all traces.
+type sankeyGroup struct {
+	traces int
+	flows  map[sankeyFlow][]int64 // durations in ms
+}
+
+type sankeyFlow struct {
+	source, target string
+}
+
+func (a *AggregatedSankeyExporter) Export(tr *flowtracker.Trace) {
+	a.ticker.run(a.window(), a.Flush)
+
+	names := sankeyNames(tr, SankeyOptions{IncludeTags: a.IncludeTags, IncludeAllTags: a.IncludeAllTags})
+	group := ""
+	if a.GroupByRoot && tr.Root != nil {
+		group = tr.Root.Name
+	}
+
+	a.mu.Lock()
+	if a.groups == nil {
+		a.groups = make(map[string]*sankeyGroup)
+		a.since = time.Now()
+	}
+	g, ok := a.groups[group]
+	if !ok {
+		g = &sankeyGroup{flows: make(map[sankeyFlow][]int64)}
+		a.groups[group] = g
+	}
+	g.traces++
+	for _, span := range tr.Spans {
+		if span.ParentID == "" {
+			continue
+		}
+		source, ok := names[span.ParentID]
+		if !ok {
+			source = "Unknown"
+		}
+		flow := sankeyFlow{source: source, target: names[span.ID]}
+		g.flows[flow] = append(g.flows[flow], span.Duration)
+	}
+	a.traces++
+	var out string
+	if a.EveryN > 0 && a.traces >= a.EveryN {
+		out = a.takeLocked()
+	}
+	a.mu.Unlock()
+
+	if out != "" {
+		writeLocked(&a.writeMu, a.Writer, out)
+	}
+}
+
+// window returns the time between two diagrams, 0 if they are only written every EveryN traces.
+func (a *AggregatedSankeyExporter) window() time.Duration {
+	if a.Window > 0 {
+		return a.Window
+	}
+	if a.EveryN > 0 {
+		return 0
+	}
+	return time.Minute
+}
+
+// Flush writes the diagram of the flows collected so far and starts over.
+func (a *AggregatedSankeyExporter) Flush() {
+	a.mu.Lock()
+	out := a.takeLocked()
+	a.mu.Unlock()
+
+	if out != "" {
+		writeLocked(&a.writeMu, a.Writer, out)
+	}
+}
+
+// Close stops the periodic writes and writes the last diagram.
+func (a *AggregatedSankeyExporter) Close() {
+	a.ticker.close()
+	a.Flush()
+}
+
+// takeLocked renders and resets the collected flows. a.mu must be held.
+func (a *AggregatedSankeyExporter) takeLocked() string {
+	groups, traces, since := a.groups, a.traces, a.since
+	a.groups, a.traces = nil, 0
+	if traces == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	aggregation := a.Aggregation
+	if aggregation == "" {
+		aggregation = SankeySum
+	}
+	var sb strings.Builder
+	for _, k := range keys {
+		g := groups[k]
+		if !a.CleanOutput {
+			scope := ""
+			if a.GroupByRoot {
+				scope = fmt.Sprintf("route: %s, ", k)
+			}
+			sb.WriteString(fmt.Sprintf("\n----- START AGGREGATED SANKEY DATA (%s%s of %d traces since %s)----\n",
+				scope, aggregation, g.traces, since.Format(time.RFC3339)))
+		}
+		sb.WriteString(renderSankeyFlows(g.flows, aggregation))
+		if !a.CleanOutput {
+			sb.WriteString("----- END AGGREGATED SANKEY DATA ----\n")
+		}
+	}
+	return sb.String()
+}
+
+// renderSankeyFlows writes one "Source [Weight] Target" line per flow, the heaviest first.
+func renderSankeyFlows(flows map[sankeyFlow][]int64, aggregation SankeyAggregation) string {
+	type line struct {
+		flow   sankeyFlow
+		weight int64
+	}
+	lines := make([]line, 0, len(flows))
+	for flow, durations := range flows {
+		lines = append(lines, line{flow: flow, weight: aggregate(durations, aggregation)})
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].weight != lines[j].weight {
+			return lines[i].weight > lines[j].weight
+		}
+		if lines[i].flow.source != lines[j].flow.source {
+			return lines[i].flow.source < lines[j].flow.source
+		}
+		return lines[i].flow.target < lines[j].flow.target
+	})
+
+	var sb strings.Builder
+	for _, l := range lines {
+		sb.WriteString(fmt.Sprintf("%s [%d] %s\n", l.flow.source, l.weight, l.flow.target))
+	}
+	return sb.String()
+}
+
+func aggregate(durations []int64, aggregation SankeyAggregation) int64 {
+	var sum int64
+	for _, d := range durations {
+		sum += d
+	}
+	switch aggregation {
+	case SankeyAvg:
+		return int64(math.Round(float64(sum) / float64(len(durations))))
+	case SankeyP95:
+		// Nearest-rank percentile
+		sorted := append([]int64(nil), durations...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		rank := int(math.Ceil(0.95 * float64(len(sorted))))
+		return sorted[max(rank, 1)-1]
+	default:
+		return sum
+	}
+}
@@ -0,0 +1,118 @@
+package exporters
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe to read while an exporter writes to it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAggregatedSankeyExporter_EveryN(t *testing.T) {
+	tests := []struct {
+		aggregation SankeyAggregation
+		expected    string
+	}{
+		{SankeySum, "GET /orders [130] Load Order\nGET /orders [120] Load Customer\nGET /orders [90] Render\n"},
+		{SankeyAvg, "GET /orders [43] Load Order\nGET /orders [40] Load Customer\nGET /orders [30] Render\n"},
+		{SankeyP95, "GET /orders [50] Load Order\nGET /orders [40] Load Customer\nGET /orders [30] Render\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.aggregation), func(t *testing.T) {
+			var buf bytes.Buffer
+			exp := &AggregatedSankeyExporter{Aggregation: tt.aggregation, EveryN: 3, CleanOutput: true, Writer: &buf}
+			for _, d := range []int64{40, 40, 50} {
+				tr := parallelTrace()
+				tr.Spans[0].Duration = d
+				exp.Export(tr)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("unexpected output:\n%s", buf.String())
+			}
+
+			// The flows start over after each diagram
+			buf.Reset()
+			exp.Export(parallelTrace())
+			exp.Flush()
+			if buf.String() != "GET /orders [40] Load Customer\nGET /orders [40] Load Order\nGET /orders [30] Render\n" {
+				t.Errorf("expected a single trace after the reset:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestAggregatedSankeyExporter_GroupByRoot(t *testing.T) {
+	var buf lockedBuffer
+	exp := &AggregatedSankeyExporter{GroupByRoot: true, Window: 20 * time.Millisecond, Writer: &buf}
+	defer exp.Close()
+
+	exp.Export(parallelTrace())
+	other := nPlusOneTrace()
+	other.Root.Name = "POST /orders"
+	exp.Export(other)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for buf.String() == "" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	out := buf.String()
+	get := strings.Index(out, "(route: GET /orders, sum of 1 traces since ")
+	post := strings.Index(out, "(route: POST /orders, sum of 1 traces since ")
+	if get < 0 || post < get {
+		t.Fatalf("expected a block per route:\n%s", out)
+	}
+	if !strings.Contains(out[post:], "Render [24] DB: Select Item\n") || strings.Contains(out[:post], "DB: Select Item") {
+		t.Errorf("expected the queries only in the POST block:\n%s", out)
+	}
+}
+
+// blockingWriter blocks every write until release is closed.
+type blockingWriter struct {
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.writing <- struct{}{}
+	<-w.release
+	return len(p), nil
+}
+
+func TestAggregatedSankeyExporter_SlowWriter(t *testing.T) {
+	w := &blockingWriter{writing: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(w.release)
+	exp := &AggregatedSankeyExporter{EveryN: 2, Writer: w}
+	exp.Export(parallelTrace())
+	go exp.Export(parallelTrace())
+	<-w.writing
+
+	// A slow write must not hold up the collection of other traces
+	exported := make(chan struct{})
+	go func() {
+		exp.Export(parallelTrace())
+		close(exported)
+	}()
+	select {
+	case <-exported:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Export blocked on the writer")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -48,7 +49,7 @@ func TestSankeyExporter_OK(t *testing.T) {
 
 	logs := buf.String()
 	output := strings.Split(logs, "\n")
-	if !strings.Contains(output[1], "----- START SANKEY DATA (trace id: trace-") {
+	if !regexp.MustCompile(`^----- START SANKEY DATA \(trace id: [0-9a-f]{32}\)----$`).MatchString(output[1]) {
 		t.Fatalf("expected log not found: %s", output[1])
 	}
 	if !strings.Contains(output[2], "GET / [") {
@@ -75,7 +76,7 @@ func TestSankeyExporter_OK(t *testing.T) {
 	if !strings.Contains(output[5], "] Calculate Weight") {
 		t.Fatalf("expected log not found: %s", output[5])
 	}
-	if !strings.Contains(output[6], "----- END SANKEY DATA (trace id: trace-") {
+	if !regexp.MustCompile(`^----- END SANKEY DATA \(trace id: [0-9a-f]{32}\)----$`).MatchString(output[6]) {
 		t.Fatalf("expected log not found: %s", output[6])
 	}
 }
@@ -135,7 +136,32 @@ func TestSankeyExporter_OK_IncludeTags(t *testing.T) {
 	if !strings.Contains(output[5], "] Calculate Weight") {
 		t.Fatalf("expected log not found: %s", output[5])
 	}
-	if !strings.Contains(output[6], "----- END SANKEY DATA (trace id: trace-") {
+	if !regexp.MustCompile(`^----- END SANKEY DATA \(trace id: [0-9a-f]{32}\)----$`).MatchString(output[6]) {
 		t.Fatalf("expected log not found: %s", output[6])
 	}
 }
+
+func TestSankeyExporter_Writer(t *testing.T) {
+	var buf bytes.Buffer
+	(&SankeyExporter{CleanOutput: true, Writer: &buf}).Export(parallelTrace())
+
+	expected := "GET /orders [40] Load Order\nGET /orders [40] Load Customer\nGET /orders [30] Render\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestRenderSankey(t *testing.T) {
+	tr := parallelTrace()
+	tr.Spans[0].Tags = map[string]string{"db.table": "orders", "db.rows": "1"}
+	flows, err := RenderSankey(tr, SankeyOptions{IncludeTags: []string{"db.table"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(flows), "GET /orders [40] Load Order (db.table:orders)\n") {
+		t.Errorf("unexpected flows:\n%s", flows)
+	}
+	if strings.Contains(string(flows), "START SANKEY DATA") {
+		t.Errorf("expected no header:\n%s", flows)
+	}
+}
@@ -0,0 +1,222 @@
+package exporters
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// SVGExporter writes every trace to a static "<trace_id>.svg" chart, for places that
+// strip JavaScript, such as wikis. Hovering a bar shows its details.
+type SVGExporter struct {
+	// Dir is the directory the charts are written to. Default: the working directory
+	Dir string
+
+	// Layout is Waterfall (one row per span) or Icicle (one row per depth). Default Waterfall.
+	Layout SVGLayout
+
+	// ColorTag colors the bars by the value of this tag, e.g. "component".
+	// Default: failed spans red, the others blue.
+	ColorTag string
+
+	// Width of the chart in pixels. Default 1200
+	Width int
+}
+
+// SVGOptions configures RenderSVG, the fields work like those of SVGExporter.
+type SVGOptions struct {
+	Layout   SVGLayout
+	ColorTag string
+	Width    int
+}
+
+type SVGLayout string
+
+var (
+	// Waterfall draws one row per span, indented by depth, with the name left of the timeline
+	Waterfall SVGLayout = "waterfall"
+	// Icicle draws one row per depth, every span below its parent at its real time
+	Icicle SVGLayout = "icicle"
+)
+
+func (e *SVGExporter) Export(tr *flowtracker.Trace) {
+	chart, err := RenderSVG(tr, SVGOptions{Layout: e.Layout, ColorTag: e.ColorTag, Width: e.Width})
+	if err == nil {
+		err = os.WriteFile(filepath.Join(e.Dir, tr.TraceID+".svg"), chart, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Error writing svg chart: %v\n", err)
+	}
+}
+
+const (
+	svgRowHeight  = 20
+	svgAxisHeight = 24
+	svgPadding    = 10
+	svgLabelWidth = 280
+	svgIndent     = 12
+)
+
+const (
+	svgColorOK    = "#4493f8"
+	svgColorError = "#e5534b"
+	svgColorNone  = "#9198a1"
+)
+
+// svgPalette colors the tag values for ColorTag
+var svgPalette = []string{"#4493f8", "#3fb950", "#d29922", "#a371f7", "#db61a2", "#39c5cf", "#f0883e", "#8b949e"}
+
+// RenderSVG returns the waterfall or icicle chart of the trace as an SVG document.
+func RenderSVG(tr *flowtracker.Trace, opts SVGOptions) ([]byte, error) {
+	if tr == nil {
+		return nil, errNilTrace
+	}
+	switch opts.Layout {
+	case "", Waterfall, Icicle:
+	default:
+		return nil, fmt.Errorf("exporters: unknown svg layout %q", opts.Layout)
+	}
+	width := opts.Width
+	if width <= 0 {
+		width = 1200
+	}
+
+	rows := spanTree(tr)
+	start, end := traceBounds(tr)
+	total := end.Sub(start)
+
+	labelWidth := svgLabelWidth
+	rowCount := len(rows)
+	if opts.Layout == Icicle {
+		labelWidth = 0
+		rowCount = 0
+		for _, r := range rows {
+			rowCount = max(rowCount, r.Depth+1)
+		}
+	}
+	left := float64(svgPadding + labelWidth)
+	scale := float64(width-svgPadding) - left
+	x := func(t time.Time) float64 {
+		if total <= 0 {
+			return left
+		}
+		return left + scale*float64(t.Sub(start))/float64(total)
+	}
+	height := svgAxisHeight + rowCount*svgRowHeight + 2*svgPadding
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Helvetica, Arial, sans-serif" font-size="12">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(&sb, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+
+	// Time axis with gridlines
+	step := svgTickStep(total)
+	for t := time.Duration(0); step > 0 && t <= total; t += step {
+		tx := x(start.Add(t))
+		fmt.Fprintf(&sb, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#d0d7de"/>`+"\n",
+			tx, svgPadding+svgAxisHeight-6, tx, height-svgPadding)
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%d" text-anchor="middle" fill="#656d76">%s</text>`+"\n",
+			tx, svgPadding+svgAxisHeight-10, svgDuration(t))
+	}
+
+	for i, r := range rows {
+		row := i
+		if opts.Layout == Icicle {
+			row = r.Depth
+		}
+		y := svgPadding + svgAxisHeight + row*svgRowHeight
+		x1, x2 := x(r.StartTime), x(r.EndTime)
+		duration := r.EndTime.Sub(r.StartTime)
+
+		sb.WriteString("<g>\n")
+		fmt.Fprintf(&sb, "<title>%s</title>\n", html.EscapeString(svgTooltip(r.Span, start)))
+		if opts.Layout == Icicle {
+			// The name is drawn inside the bar and clipped by it
+			fmt.Fprintf(&sb, `<svg x="%.1f" y="%d" width="%.1f" height="%d">`+"\n", x1, y+1, math.Max(x2-x1, 1), svgRowHeight-2)
+			fmt.Fprintf(&sb, `<rect width="100%%" height="100%%" fill="%s" stroke="#ffffff"/>`+"\n", svgColor(r.Span, opts.ColorTag))
+			fmt.Fprintf(&sb, `<text x="4" y="%d" fill="#ffffff">%s</text>`+"\n", svgRowHeight-7, html.EscapeString(r.Name))
+			sb.WriteString("</svg>\n")
+		} else {
+			fmt.Fprintf(&sb, `<text x="%d" y="%d">%s</text>`+"\n",
+				svgPadding+r.Depth*svgIndent, y+svgRowHeight-6, html.EscapeString(svgTruncate(r.Name, r.Depth)))
+			fmt.Fprintf(&sb, `<rect x="%.1f" y="%d" width="%.1f" height="%d" rx="2" fill="%s"/>`+"\n",
+				x1, y+3, math.Max(x2-x1, 1), svgRowHeight-6, svgColor(r.Span, opts.ColorTag))
+			fmt.Fprintf(&sb, `<text x="%.1f" y="%d" fill="#656d76">%s</text>`+"\n",
+				x2+4, y+svgRowHeight-6, svgDuration(duration))
+		}
+		sb.WriteString("</g>\n")
+	}
+	sb.WriteString("</svg>\n")
+	return []byte(sb.String()), nil
+}
+
+// svgTickStep returns a 1, 2 or 5 times power of ten step giving at most 10 ticks.
+func svgTickStep(total time.Duration) time.Duration {
+	if total <= 0 {
+		return 0
+	}
+	step := time.Duration(1)
+	for {
+		for _, m := range []time.Duration{1, 2, 5} {
+			if total/(step*m) <= 10 {
+				return step * m
+			}
+		}
+		step *= 10
+	}
+}
+
+// svgDuration formats d in milliseconds, or microseconds below one millisecond.
+func svgDuration(d time.Duration) string {
+	if d > 0 && d < time.Millisecond {
+		return fmt.Sprintf("%dµs", d.Microseconds())
+	}
+	return fmt.Sprintf("%gms", float64(d.Microseconds())/1000)
+}
+
+// svgTruncate shortens names that would run into the timeline.
+func svgTruncate(name string, depth int) string {
+	limit := (svgLabelWidth-depth*svgIndent)/7 - 1
+	if r := []rune(name); len(r) > limit && limit > 1 {
+		return string(r[:limit-1]) + "…"
+	}
+	return name
+}
+
+func svgColor(s *flowtracker.Span, colorTag string) string {
+	if colorTag == "" {
+		if s.Tags["error"] == "true" {
+			return svgColorError
+		}
+		return svgColorOK
+	}
+	v, ok := s.Tags[colorTag]
+	if !ok {
+		return svgColorNone
+	}
+	// The same value gets the same color in every chart
+	h := fnv.New32a()
+	h.Write([]byte(v))
+	return svgPalette[h.Sum32()%uint32(len(svgPalette))]
+}
+
+func svgTooltip(s *flowtracker.Span, start time.Time) string {
+	lines := []string{
+		s.Name,
+		fmt.Sprintf("start +%s, duration %s", svgDuration(s.StartTime.Sub(start)), svgDuration(s.EndTime.Sub(s.StartTime))),
+	}
+	for _, k := range sortedKeys(s.Tags) {
+		lines = append(lines, fmt.Sprintf("%s: %s", k, s.Tags[k]))
+	}
+	for _, ev := range s.Events {
+		lines = append(lines, fmt.Sprintf("event %s at +%s", ev.Name, svgDuration(ev.Time.Sub(start))))
+	}
+	return strings.Join(lines, "\n")
+}
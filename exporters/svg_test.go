@@ -0,0 +1,91 @@
+package exporters
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// svgElements parses the SVG and counts its elements by name.
+func svgElements(t *testing.T, chart []byte) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	dec := xml.NewDecoder(strings.NewReader(string(chart)))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return counts
+		}
+		if err != nil {
+			t.Fatalf("invalid svg: %v\n%s", err, chart)
+		}
+		if el, ok := tok.(xml.StartElement); ok {
+			counts[el.Name.Local]++
+		}
+	}
+}
+
+func TestRenderSVG_Waterfall(t *testing.T) {
+	tr := nPlusOneTrace()
+	tr.Spans[0].Name = "Load <Order> & Items"
+	chart, err := RenderSVG(tr, SVGOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(chart)
+
+	counts := svgElements(t, chart)
+	if counts["title"] != 7 || counts["rect"] != 8 {
+		t.Errorf("expected a bar and a tooltip per span, got %v", counts)
+	}
+	// 100ms trace: ticks every 10ms from 0ms to 100ms
+	if counts["line"] != 11 || !strings.Contains(out, ">0ms</text>") || !strings.Contains(out, ">100ms</text>") {
+		t.Errorf("unexpected time axis:\n%s", out)
+	}
+	if !strings.Contains(out, "<title>Load Customer\nstart +20ms, duration 40ms\ncomponent: http\nerror: true</title>") {
+		t.Errorf("expected the tooltip with tags:\n%s", out)
+	}
+	if strings.Count(out, svgColorError) != 1 || !strings.Contains(out, "Load &lt;Order&gt; &amp; Items") {
+		t.Errorf("expected the failed span red and names escaped:\n%s", out)
+	}
+	// One row per span, children indented
+	if !strings.Contains(out, `<text x="22" y="`) || !strings.Contains(out, `<text x="34" y="`) {
+		t.Errorf("expected indented labels:\n%s", out)
+	}
+}
+
+func TestRenderSVG_IcicleByTag(t *testing.T) {
+	chart, err := RenderSVG(nPlusOneTrace(), SVGOptions{Layout: Icicle, ColorTag: "component", Width: 600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(chart)
+	svgElements(t, chart)
+	// Root, children and queries: three depths
+	if !strings.Contains(out, `width="600" height="104"`) {
+		t.Errorf("expected 3 rows:\n%s", out)
+	}
+	if strings.Count(out, svgColorNone) != 3 || strings.Count(out, svgColor(nPlusOneTrace().Spans[4], "component")) != 3 {
+		t.Errorf("expected colors by component:\n%s", out)
+	}
+
+	if _, err := RenderSVG(nPlusOneTrace(), SVGOptions{Layout: "pie"}); err == nil {
+		t.Error("expected an error for an unknown layout")
+	}
+}
+
+func TestSVGExporter(t *testing.T) {
+	dir := t.TempDir()
+	(&SVGExporter{Dir: dir}).Export(parallelTrace())
+
+	b, err := os.ReadFile(filepath.Join(dir, "4bf92f3577b34da6a3ce929d0e0e4736.svg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), `<svg xmlns="http://www.w3.org/2000/svg"`) {
+		t.Errorf("unexpected chart:\n%s", b)
+	}
+}
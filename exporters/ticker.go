@@ -0,0 +1,48 @@
+package exporters
+
+import (
+	"sync"
+	"time"
+)
+
+// flushTicker calls flush periodically for exporters that aggregate many traces.
+type flushTicker struct {
+	start sync.Once
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// run starts calling flush every interval in the background. Only the first call starts
+// it, later ones are no-ops, so exporters call it on every Export. A non-positive interval
+// doesn't start it.
+func (t *flushTicker) run(interval time.Duration, flush func()) {
+	t.start.Do(func() {
+		if interval <= 0 {
+			return
+		}
+		t.stop, t.done = make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(t.done)
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					flush()
+				case <-t.stop:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// close stops the periodic flushes, waiting for a running one, and keeps them from starting later.
+func (t *flushTicker) close() {
+	t.start.Do(func() {})
+	if t.stop != nil {
+		close(t.stop)
+		<-t.done
+		t.stop = nil
+	}
+}
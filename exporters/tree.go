@@ -0,0 +1,63 @@
+package exporters
+
+import (
+	"sort"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// treeSpan is a span with its position in the span tree.
+type treeSpan struct {
+	*flowtracker.Span
+	Depth       int
+	HasChildren bool
+}
+
+// spanTree returns the spans depth first, children by start time, so every span is
+// followed by its descendants. Spans whose parent is not in the trace become roots.
+func spanTree(tr *flowtracker.Trace) []treeSpan {
+	spans := append([]*flowtracker.Span(nil), tr.Spans...)
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].StartTime.Before(spans[j].StartTime)
+	})
+	known := make(map[string]bool, len(spans))
+	for _, s := range spans {
+		known[s.ID] = true
+	}
+	children := make(map[string][]*flowtracker.Span)
+	var roots []*flowtracker.Span
+	for _, s := range spans {
+		if known[s.ParentID] {
+			children[s.ParentID] = append(children[s.ParentID], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+
+	out := make([]treeSpan, 0, len(spans))
+	var walk func(s *flowtracker.Span, depth int)
+	walk = func(s *flowtracker.Span, depth int) {
+		out = append(out, treeSpan{Span: s, Depth: depth, HasChildren: len(children[s.ID]) > 0})
+		for _, c := range children[s.ID] {
+			walk(c, depth+1)
+		}
+	}
+	for _, s := range roots {
+		walk(s, 0)
+	}
+	return out
+}
+
+// traceBounds returns the earliest start and the latest end of the spans.
+func traceBounds(tr *flowtracker.Trace) (start, end time.Time) {
+	for i, s := range tr.Spans {
+		if i == 0 || s.StartTime.Before(start) {
+			start = s.StartTime
+		}
+		if i == 0 || s.EndTime.After(end) {
+			end = s.EndTime
+		}
+	}
+	return start, end
+}
@@ -0,0 +1,21 @@
+package exporters
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+var errNilTrace = errors.New("exporters: nil trace")
+
+// writeLocked writes s to w, or os.Stdout if w is nil. mu serializes the writes of
+// one exporter, traces are exported concurrently.
+func writeLocked(mu *sync.Mutex, w io.Writer, s string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if w == nil {
+		w = os.Stdout
+	}
+	io.WriteString(w, s)
+}
@@ -0,0 +1,204 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// ZipkinExporter sends traces as Zipkin v2 JSON spans to a Zipkin server.
+//
+// Call Flush on shutdown to send the traces still waiting in a batch.
+type ZipkinExporter struct {
+	// Endpoint is the full URL of the spans endpoint. Default "http://localhost:9411/api/v2/spans"
+	Endpoint string
+
+	// ServiceName is the localEndpoint of every span. Default: the service name of the trace resource
+	ServiceName string
+
+	// Headers are added to every request
+	Headers map[string]string
+
+	// BatchSize is the number of traces sent in one request. Default 1 (no batching)
+	BatchSize int
+
+	// BatchTimeout sends an incomplete batch once its first trace waited this long. Default 5s
+	BatchTimeout time.Duration
+
+	// Client sends the requests. Default: an http.Client with a 10s timeout
+	Client *http.Client
+
+	// OnError is called when a batch could not be delivered. Default: prints the error
+	OnError func(err error)
+
+	batcher traceBatcher
+}
+
+// Export adds the trace to the current batch and sends the batch once it is full.
+func (e *ZipkinExporter) Export(tr *flowtracker.Trace) {
+	if batch := e.batcher.add(tr, e.BatchSize, e.BatchTimeout, e.Flush); batch != nil {
+		e.send(batch)
+	}
+}
+
+// Flush sends the traces waiting in the current batch.
+func (e *ZipkinExporter) Flush() {
+	if batch := e.batcher.take(); len(batch) > 0 {
+		e.send(batch)
+	}
+}
+
+func (e *ZipkinExporter) send(batch []*flowtracker.Trace) {
+	var spans []zipkinSpan
+	for _, tr := range batch {
+		spans = append(spans, e.convert(tr)...)
+	}
+	body, err := json.Marshal(spans)
+	if err != nil {
+		e.error(fmt.Errorf("zipkin: failed to encode spans: %w", err))
+		return
+	}
+
+	endpoint := e.Endpoint
+	if endpoint == "" {
+		endpoint = "http://localhost:9411/api/v2/spans"
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		e.error(fmt.Errorf("zipkin: %w", err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		e.error(fmt.Errorf("zipkin: failed to send %d spans: %w", len(spans), err))
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		e.error(fmt.Errorf("zipkin: failed to send %d spans: unexpected response: %s", len(spans), resp.Status))
+	}
+}
+
+func (e *ZipkinExporter) error(err error) {
+	if e.OnError != nil {
+		e.OnError(err)
+		return
+	}
+	fmt.Printf("FlowTracker Zipkin Error: %v\n", err)
+}
+
+// ---------------------------------------------------------
+// Zipkin v2 model (zipkin2-api.yaml)
+// ---------------------------------------------------------
+
+type zipkinSpan struct {
+	TraceID        string             `json:"traceId"`
+	ID             string             `json:"id"`
+	ParentID       string             `json:"parentId,omitempty"`
+	Name           string             `json:"name"`
+	Kind           string             `json:"kind,omitempty"`
+	Timestamp      int64              `json:"timestamp"`
+	Duration       int64              `json:"duration"`
+	LocalEndpoint  *zipkinEndpoint    `json:"localEndpoint,omitempty"`
+	RemoteEndpoint *zipkinEndpoint    `json:"remoteEndpoint,omitempty"`
+	Annotations    []zipkinAnnotation `json:"annotations,omitempty"`
+	Tags           map[string]string  `json:"tags,omitempty"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinAnnotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// Zipkin has no kind for internal spans, they leave it empty
+var zipkinKinds = map[flowtracker.SpanKind]string{
+	flowtracker.SpanKindServer:   "SERVER",
+	flowtracker.SpanKindClient:   "CLIENT",
+	flowtracker.SpanKindProducer: "PRODUCER",
+	flowtracker.SpanKindConsumer: "CONSUMER",
+}
+
+func (e *ZipkinExporter) convert(tr *flowtracker.Trace) []zipkinSpan {
+	var local *zipkinEndpoint
+	if name := e.ServiceName; name != "" {
+		local = &zipkinEndpoint{ServiceName: name}
+	} else if tr.Resource != nil && tr.Resource.ServiceName != "" {
+		local = &zipkinEndpoint{ServiceName: tr.Resource.ServiceName}
+	}
+
+	spans := make([]zipkinSpan, 0, len(tr.Spans))
+	for _, s := range tr.Spans {
+		span := zipkinSpan{
+			TraceID:       tr.TraceID,
+			ID:            s.ID,
+			ParentID:      s.ParentID,
+			Name:          s.Name,
+			Kind:          zipkinKinds[s.Kind],
+			Timestamp:     s.StartTime.UnixMicro(),
+			Duration:      s.EndTime.Sub(s.StartTime).Microseconds(),
+			LocalEndpoint: local,
+			Tags:          make(map[string]string, len(s.Tags)),
+		}
+		// Zipkin rejects a zero duration, round sub-microsecond spans up
+		if span.Duration < 1 {
+			span.Duration = 1
+		}
+		if s == tr.Root {
+			span.ParentID = tr.RemoteParentID
+			for k, v := range tr.Attributes {
+				span.Tags[k] = v
+			}
+		}
+		for k, v := range s.Tags {
+			span.Tags[k] = v
+		}
+		// Zipkin marks failed spans with an "error" tag holding the message
+		if s.Tags["error"] == "true" && s.Tags["error.message"] != "" {
+			span.Tags["error"] = s.Tags["error.message"]
+		}
+		if peer := s.Tags["peer.service"]; peer != "" {
+			span.RemoteEndpoint = &zipkinEndpoint{ServiceName: peer}
+		}
+		for _, ev := range s.Events {
+			span.Annotations = append(span.Annotations, zipkinAnnotation{
+				Timestamp: ev.Time.UnixMicro(),
+				Value:     annotationValue(ev),
+			})
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// annotationValue renders an event as "name key=value ...", annotations have no attributes.
+func annotationValue(ev flowtracker.SpanEvent) string {
+	if len(ev.Attributes) == 0 {
+		return ev.Name
+	}
+	var sb strings.Builder
+	sb.WriteString(ev.Name)
+	for _, k := range sortedKeys(ev.Attributes) {
+		fmt.Fprintf(&sb, " %s=%s", k, ev.Attributes[k])
+	}
+	return sb.String()
+}
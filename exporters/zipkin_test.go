@@ -0,0 +1,63 @@
+package exporters
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestZipkinExporter(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/spans" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		b, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+		bodies <- b
+	}))
+	defer srv.Close()
+
+	exp := &ZipkinExporter{Endpoint: srv.URL + "/api/v2/spans", BatchSize: 2}
+	exp.Export(otlpTestTrace("4bf92f3577b34da6a3ce929d0e0e4736"))
+	exp.Export(otlpTestTrace("0af7651916cd43dd8448eb211c80319c"))
+
+	var spans []zipkinSpan
+	select {
+	case b := <-bodies:
+		if err := json.Unmarshal(b, &spans); err != nil {
+			t.Fatalf("invalid payload: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for spans")
+	}
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans in one batch, got %d", len(spans))
+	}
+
+	root, child := spans[0], spans[1]
+	if root.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || root.ParentID != "b9c7c989f97918e1" || root.Kind != "SERVER" {
+		t.Errorf("unexpected root span: %+v", root)
+	}
+	if root.Timestamp != 1700000000000000 || root.Duration != 50000 {
+		t.Errorf("expected microsecond timestamps, got %d/%d", root.Timestamp, root.Duration)
+	}
+	if root.LocalEndpoint == nil || root.LocalEndpoint.ServiceName != "orders" {
+		t.Errorf("unexpected local endpoint: %+v", root.LocalEndpoint)
+	}
+	if root.Tags["error"] != "boom" || root.Tags["user.id"] != "42" {
+		t.Errorf("unexpected root tags: %v", root.Tags)
+	}
+	if child.ParentID != root.ID || child.Kind != "CLIENT" || child.Tags["db.system"] != "postgres" {
+		t.Errorf("unexpected child span: %+v", child)
+	}
+	if len(child.Annotations) != 1 || child.Annotations[0].Value != "retry attempt=2" || child.Annotations[0].Timestamp != 1700000000002000 {
+		t.Errorf("unexpected annotations: %+v", child.Annotations)
+	}
+	if spans[2].TraceID != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("expected the second trace, got %s", spans[2].TraceID)
+	}
+}
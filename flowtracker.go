@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"math/rand"
+	"io"
 	"net/http"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -18,17 +20,125 @@ type Span struct {
 	ID        string            `json:"span_id"`
 	ParentID  string            `json:"parent_id,omitempty"`
 	Name      string            `json:"name"`
+	Kind      SpanKind          `json:"kind,omitempty"`
 	StartTime time.Time         `json:"start_time"`
 	EndTime   time.Time         `json:"end_time"`
 	Duration  int64             `json:"duration_ms"`
 	Tags      map[string]string `json:"tags,omitempty"`
+	// TagTypes records the type of the tags added with AddTagInt, AddTagFloat or AddTagBool,
+	// for exporters with typed attributes. Tags without an entry are strings.
+	TagTypes map[string]TagType `json:"tag_types,omitempty"`
+	// Links point to related spans that are not the parent, e.g. the producer of a consumed message.
+	Links []SpanContext `json:"links,omitempty"`
+	// Events are points in time within the span, e.g. a retry or a cache miss.
+	Events []SpanEvent `json:"events,omitempty"`
+}
+
+// SpanEvent is something that happened at a point in time during a span
+type SpanEvent struct {
+	Name       string            `json:"name"`
+	Time       time.Time         `json:"time"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// SpanKind describes the role of a span in a remote call.
+// An empty kind means SpanKindInternal.
+type SpanKind string
+
+const (
+	SpanKindInternal SpanKind = "internal"
+	SpanKindServer   SpanKind = "server"
+	SpanKindClient   SpanKind = "client"
+	SpanKindProducer SpanKind = "producer"
+	SpanKindConsumer SpanKind = "consumer"
+)
+
+// TagType is the type a tag value was added with. Tags are stored as strings,
+// exporters with typed attributes such as OTLP use it to send the original type.
+type TagType string
+
+const (
+	TagTypeString TagType = ""
+	TagTypeBool   TagType = "bool"
+	TagTypeInt    TagType = "int"
+	TagTypeFloat  TagType = "float"
+)
+
+// TypedValue returns value as a bool, int64 or float64 according to typ. Strings, and
+// values that don't parse as their type (e.g. masked by redaction), are returned as is.
+func TypedValue(value string, typ TagType) any {
+	switch typ {
+	case TagTypeBool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case TagTypeInt:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case TagTypeFloat:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// SpanOption configures a span when it is started
+type SpanOption func(*Span)
+
+// WithSpanKind sets the kind of the span, e.g. SpanKindClient for outgoing calls
+func WithSpanKind(kind SpanKind) SpanOption {
+	return func(s *Span) {
+		s.Kind = kind
+	}
+}
+
+// WithLinks links the span to other spans, invalid span contexts are ignored
+func WithLinks(links ...SpanContext) SpanOption {
+	return func(s *Span) {
+		for _, l := range links {
+			if l.IsValid() {
+				s.Links = append(s.Links, l)
+			}
+		}
+	}
 }
 
 type Trace struct {
-	TraceID string  `json:"trace_id"`
-	Root    *Span   `json:"-"`
-	Spans   []*Span `json:"spans"`
-	mu      sync.Mutex
+	TraceID string `json:"trace_id"`
+	// RemoteParentID is the span in the calling service that this trace continues, if any.
+	RemoteParentID string            `json:"remote_parent_id,omitempty"`
+	Root           *Span             `json:"-"`
+	Spans          []*Span           `json:"spans"`
+	Attributes     map[string]string `json:"attributes,omitempty"`
+	Resource       *Resource         `json:"resource,omitempty"`
+	mu             sync.Mutex
+	cfg            *config
+	// ended is set once the root span ended and the trace is handed to the exporters
+	ended bool
+}
+
+// AddSpan adds a finished span recorded outside of StartSpan, e.g. by another tracing
+// API, to the trace. It reports false if the trace already ended, as exporters may
+// be reading it; such spans are lost.
+func (t *Trace) AddSpan(s *Span) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ended {
+		return false
+	}
+	t.Spans = append(t.Spans, s)
+	return true
+}
+
+// Attr returns the trace-level attribute stored under key.
+// Exporters use it to filter, route or key traces.
+func (t *Trace) Attr(key string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	v, ok := t.Attributes[key]
+	return v, ok
 }
 
 // ---------------------------------------------------------
@@ -41,11 +151,36 @@ type Exporter interface {
 }
 
 // ConsoleExporter -- Default Impl 1: Console Exporter (JSON to Stdout) --
-type ConsoleExporter struct{}
+type ConsoleExporter struct {
+	// Writer receives the "FLOW_LOG: <json>" lines. Default os.Stdout
+	Writer io.Writer
+
+	mu sync.Mutex
+}
 
 func (c *ConsoleExporter) Export(tr *Trace) {
 	b, _ := json.Marshal(tr)
-	fmt.Printf("FLOW_LOG: %s\n", string(b))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := c.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	fmt.Fprintf(w, "FLOW_LOG: %s\n", string(b))
+}
+
+// SpanProcessor is notified synchronously when a span starts and ends.
+// Unlike an Exporter, it sees every span as it happens, which makes it the place
+// for default tags, naming rules or real-time metrics.
+//
+// Processors run on the request path, so they must be fast and safe for concurrent use.
+type SpanProcessor interface {
+	// OnStart is called before the span becomes visible to the trace.
+	// ctx is the parent context the span is started from. The span may be modified.
+	OnStart(ctx context.Context, span *Span)
+	// OnEnd is called once the span's EndTime and Duration are set.
+	OnEnd(span *Span)
 }
 
 // ---------------------------------------------------------
@@ -53,7 +188,14 @@ func (c *ConsoleExporter) Export(tr *Trace) {
 // ---------------------------------------------------------
 
 type config struct {
-	exporters []Exporter
+	exporters  []Exporter
+	processors []SpanProcessor
+	redactor   *redactor
+	resource   *Resource
+	bridge     ContextBridge
+
+	baggageTags   bool
+	baggagePrefix string
 }
 
 type Option func(*config)
@@ -65,6 +207,31 @@ func WithExporter(e ...Exporter) Option {
 	}
 }
 
+// WithSpanProcessor registers processors that are called when spans start and end
+func WithSpanProcessor(p ...SpanProcessor) Option {
+	return func(c *config) {
+		c.processors = append(c.processors, p...)
+	}
+}
+
+func (c *config) onStart(ctx context.Context, span *Span) {
+	if c == nil {
+		return
+	}
+	for _, p := range c.processors {
+		p.OnStart(ctx, span)
+	}
+}
+
+func (c *config) onEnd(span *Span) {
+	if c == nil {
+		return
+	}
+	for _, p := range c.processors {
+		p.OnEnd(span)
+	}
+}
+
 // ---------------------------------------------------------
 // 4. Middleware & Logic
 // ---------------------------------------------------------
@@ -74,10 +241,19 @@ type key int
 const (
 	traceKey      key = 0
 	parentSpanKey key = 1
+	baggageKey    key = 2
+	remoteSpanKey key = 3
 )
 
-// NewMiddleware creates the handler wrapper with the provided options
-func NewMiddleware(opts ...Option) func(http.Handler) http.Handler {
+// Tracer starts traces and exports them once they finish.
+// NewMiddleware uses one for every HTTP request; use it directly for other entry
+// points such as gRPC servers, message consumers or background jobs.
+type Tracer struct {
+	cfg *config
+}
+
+// NewTracer creates a Tracer with the provided options
+func NewTracer(opts ...Option) *Tracer {
 	cfg := &config{
 		exporters: make([]Exporter, 0),
 	}
@@ -92,84 +268,184 @@ func NewMiddleware(opts ...Option) func(http.Handler) http.Handler {
 		cfg.exporters = append(cfg.exporters, &ConsoleExporter{})
 	}
 
+	// Resolve the service resource once, user values win over detected ones
+	resource := DetectResource().merge(cfg.resource)
+	cfg.resource = &resource
+
+	return &Tracer{cfg: cfg}
+}
+
+// NewMiddleware creates the handler wrapper with the provided options
+func NewMiddleware(opts ...Option) func(http.Handler) http.Handler {
+	t := NewTracer(opts...)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// 1. Initialize Trace
-			traceID := fmt.Sprintf("trace-%d-%d", time.Now().UnixNano(), rand.Intn(1000))
-			rootSpan := &Span{
-				ID:        fmt.Sprintf("%d", rand.Intn(100000)),
-				Name:      fmt.Sprintf("%s %s", r.Method, r.URL.Path),
-				StartTime: time.Now(),
-			}
+			// 1. Initialize Trace, continuing the caller's trace and baggage if sent
+			ctx := ExtractHeaders(r.Context(), r.Header)
+			ctx, end := t.StartTrace(ctx, fmt.Sprintf("%s %s", r.Method, r.URL.Path), WithSpanKind(SpanKindServer))
 
-			tr := &Trace{
-				TraceID: traceID,
-				Root:    rootSpan,
-				Spans:   []*Span{rootSpan},
-			}
+			// 2. Serve Request
+			next.ServeHTTP(w, r.WithContext(ctx))
 
-			// 2. Inject into Context
-			ctx := context.WithValue(r.Context(), traceKey, tr)
-			ctx = context.WithValue(ctx, parentSpanKey, rootSpan.ID)
+			// 3. Finalize Root Span & Export
+			end()
+		})
+	}
+}
 
-			// 3. Serve Request
-			next.ServeHTTP(w, r.WithContext(ctx))
+// StartTrace starts a new trace whose root span is called name.
+// If ctx carries a span context (a remote parent extracted from a carrier, or a span of
+// another trace), the new trace continues it: it keeps the TraceID and records the
+// parent in RemoteParentID.
+// The returned function ends the root span and exports the trace to all exporters.
+func (t *Tracer) StartTrace(ctx context.Context, name string, opts ...SpanOption) (context.Context, func()) {
+	cfg := t.cfg
+
+	// 1. Initialize Trace
+	traceID := newTraceID()
+	var remoteParentID string
+	if parent := cfg.parentSpanContext(ctx); parent.IsValid() {
+		traceID = parent.TraceID
+		remoteParentID = parent.SpanID
+	}
+
+	rootSpan := &Span{
+		ID:        newSpanID(),
+		Name:      name,
+		StartTime: time.Now(),
+	}
+	for _, opt := range opts {
+		opt(rootSpan)
+	}
+	cfg.applyBaggageTags(ctx, rootSpan)
+	cfg.onStart(ctx, rootSpan)
+
+	tr := &Trace{
+		TraceID:        traceID,
+		RemoteParentID: remoteParentID,
+		Root:           rootSpan,
+		Spans:          []*Span{rootSpan},
+		Resource:       cfg.resource,
+		cfg:            cfg,
+	}
 
-			// 4. Finalize Root Span
-			rootSpan.EndTime = time.Now()
-			rootSpan.Duration = rootSpan.EndTime.Sub(rootSpan.StartTime).Milliseconds()
-
-			// 5. Export to ALL registered exporters
-			// We run this in a goroutine so we don't block the API response
-			go func() {
-				// Loop through the slice and call Export on each
-				for _, exp := range cfg.exporters {
-					// Wrap in anonymous func to handle panics individually
-					func(e Exporter) {
-						defer func() {
-							// With this recover() logic inside the loop: If one of the multiple exporters are down, then this won't stop the other exporters from working
-							if r := recover(); r != nil {
-								fmt.Printf("FlowTracker Exporter Panic: %v\n", r)
-							}
-						}()
-						e.Export(tr)
-					}(exp)
+	// 2. Inject into Context
+	ctx = context.WithValue(ctx, traceKey, tr)
+	ctx = context.WithValue(ctx, parentSpanKey, rootSpan.ID)
+	ctx = cfg.activate(ctx, SpanContext{TraceID: traceID, SpanID: rootSpan.ID})
+
+	return ctx, func() {
+		// 3. Finalize Root Span
+		rootSpan.EndTime = time.Now()
+		rootSpan.Duration = rootSpan.EndTime.Sub(rootSpan.StartTime).Milliseconds()
+		cfg.onEnd(rootSpan)
+		tr.mu.Lock()
+		tr.ended = true
+		tr.mu.Unlock()
+
+		// 4. Export to ALL registered exporters
+		// We run this in a goroutine so we don't block the API response
+		go cfg.export(tr)
+	}
+}
+
+func (c *config) export(tr *Trace) {
+	// Scrub sensitive tags once, so every exporter sees the same redacted trace
+	if c.redactor != nil {
+		c.redactor.redactTrace(tr)
+	}
+
+	// Loop through the slice and call Export on each
+	for _, exp := range c.exporters {
+		// Wrap in anonymous func to handle panics individually
+		func(e Exporter) {
+			defer func() {
+				// With this recover() logic inside the loop: If one of the multiple exporters are down, then this won't stop the other exporters from working
+				if r := recover(); r != nil {
+					fmt.Printf("FlowTracker Exporter Panic: %v\n", r)
 				}
 			}()
-		})
+			e.Export(tr)
+		}(exp)
 	}
 }
 
 // StartSpan starts a new step in the flow
-func StartSpan(ctx context.Context, name string) (context.Context, func()) {
+func StartSpan(ctx context.Context, name string, opts ...SpanOption) (context.Context, func()) {
 	trace, ok := ctx.Value(traceKey).(*Trace)
 	if !ok {
 		return ctx, func() {}
 	}
 
 	parentID, _ := ctx.Value(parentSpanKey).(string)
+	// A span of a bridged API started below the current span is the closer parent
+	if sc, ok := trace.cfg.bridgedSpanContext(ctx); ok && sc.TraceID == trace.TraceID {
+		parentID = sc.SpanID
+	}
 
 	span := &Span{
-		ID:        fmt.Sprintf("%d", rand.Intn(1000000)),
+		ID:        newSpanID(),
 		ParentID:  parentID,
 		Name:      name,
 		StartTime: time.Now(),
 	}
+	for _, opt := range opts {
+		opt(span)
+	}
+	trace.cfg.applyBaggageTags(ctx, span)
+	trace.cfg.onStart(ctx, span)
 
 	trace.mu.Lock()
 	trace.Spans = append(trace.Spans, span)
 	trace.mu.Unlock()
 
 	newCtx := context.WithValue(ctx, parentSpanKey, span.ID)
+	newCtx = trace.cfg.activate(newCtx, SpanContext{TraceID: trace.TraceID, SpanID: span.ID})
 
 	return newCtx, func() {
+		// A span ended after its trace is left as exported, exporters may be reading it
+		trace.mu.Lock()
+		if trace.ended {
+			trace.mu.Unlock()
+			return
+		}
 		span.EndTime = time.Now()
 		span.Duration = span.EndTime.Sub(span.StartTime).Milliseconds()
+		trace.mu.Unlock()
+		trace.cfg.onEnd(span)
 	}
 }
 
-// AddTag adds metadata to the current span
+// TraceFromContext returns the trace carried by ctx, if any
+func TraceFromContext(ctx context.Context) (*Trace, bool) {
+	trace, ok := ctx.Value(traceKey).(*Trace)
+	return trace, ok
+}
+
+// AddTag adds metadata to the current span.
+// Tags added once the trace ended are ignored, as exporters may be reading it.
 func AddTag(ctx context.Context, key, value string) {
+	addTag(ctx, key, value, TagTypeString)
+}
+
+// AddTagInt adds an integer tag to the current span, e.g. a status code or a row count.
+// Exporters with typed attributes send it as an integer.
+func AddTagInt(ctx context.Context, key string, value int64) {
+	addTag(ctx, key, strconv.FormatInt(value, 10), TagTypeInt)
+}
+
+// AddTagFloat adds a floating point tag to the current span.
+func AddTagFloat(ctx context.Context, key string, value float64) {
+	addTag(ctx, key, strconv.FormatFloat(value, 'g', -1, 64), TagTypeFloat)
+}
+
+// AddTagBool adds a boolean tag to the current span.
+func AddTagBool(ctx context.Context, key string, value bool) {
+	addTag(ctx, key, strconv.FormatBool(value), TagTypeBool)
+}
+
+func addTag(ctx context.Context, key, value string, typ TagType) {
 	trace, ok := ctx.Value(traceKey).(*Trace)
 	if !ok {
 		return
@@ -178,6 +454,9 @@ func AddTag(ctx context.Context, key, value string) {
 
 	trace.mu.Lock()
 	defer trace.mu.Unlock()
+	if trace.ended {
+		return
+	}
 
 	for _, s := range trace.Spans {
 		if s.ID == currentSpanID {
@@ -185,7 +464,63 @@ func AddTag(ctx context.Context, key, value string) {
 				s.Tags = make(map[string]string)
 			}
 			s.Tags[key] = value
+			if typ == TagTypeString {
+				delete(s.TagTypes, key)
+			} else {
+				if s.TagTypes == nil {
+					s.TagTypes = make(map[string]TagType)
+				}
+				s.TagTypes[key] = typ
+			}
+			break
+		}
+	}
+}
+
+// AddEvent records an event with optional attributes on the current span.
+// Like tags, events recorded once the trace ended are ignored.
+func AddEvent(ctx context.Context, name string, attrs map[string]string) {
+	trace, ok := ctx.Value(traceKey).(*Trace)
+	if !ok {
+		return
+	}
+	currentSpanID, _ := ctx.Value(parentSpanKey).(string)
+	event := SpanEvent{Name: name, Time: time.Now()}
+	if len(attrs) > 0 {
+		// Copy, so the caller can't change the event afterwards
+		event.Attributes = make(map[string]string, len(attrs))
+		for k, v := range attrs {
+			event.Attributes[k] = v
+		}
+	}
+
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	if trace.ended {
+		return
+	}
+
+	for _, s := range trace.Spans {
+		if s.ID == currentSpanID {
+			s.Events = append(s.Events, event)
 			break
 		}
 	}
 }
+
+// SetTraceAttr adds metadata describing the whole request (user ID, tenant, A/B bucket)
+// to the trace itself, no matter which span is current
+func SetTraceAttr(ctx context.Context, key, value string) {
+	trace, ok := ctx.Value(traceKey).(*Trace)
+	if !ok {
+		return
+	}
+
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	if trace.Attributes == nil {
+		trace.Attributes = make(map[string]string)
+	}
+	trace.Attributes[key] = value
+}
@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -48,7 +50,7 @@ func TestDefaultExporter_OK(t *testing.T) {
 
 	logs := buf.String()
 
-	if !strings.Contains(logs, "FLOW_LOG: {\"trace_id\":\"trace-") {
+	if !regexp.MustCompile(`FLOW_LOG: {"trace_id":"[0-9a-f]{32}"`).MatchString(logs) {
 		t.Fatalf("expected log not found: %s", logs)
 	}
 
@@ -192,3 +194,208 @@ func TestEndToEndFlow_ConsoleExporter(t *testing.T) {
 		t.Error("Did not find the expected 'test.tag' in the trace output")
 	}
 }
+
+// recordingProcessor tags every span on start and records the names of ended spans.
+type recordingProcessor struct {
+	mu    sync.Mutex
+	ended []string
+}
+
+func (p *recordingProcessor) OnStart(ctx context.Context, span *Span) {
+	if span.Tags == nil {
+		span.Tags = make(map[string]string)
+	}
+	span.Tags["pod"] = "pod-1"
+}
+
+func (p *recordingProcessor) OnEnd(span *Span) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ended = append(p.ended, span.Name)
+}
+
+func TestSpanProcessor_OnStartOnEnd(t *testing.T) {
+	proc := &recordingProcessor{}
+	exp := newChanExporter()
+	mw := NewMiddleware(WithExporter(exp), WithSpanProcessor(proc))
+
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, finish := StartSpan(r.Context(), "Outer")
+		_, end := StartSpan(ctx, "Inner")
+		end()
+
+		// Ended spans are reported synchronously, before the trace is exported
+		proc.mu.Lock()
+		if len(proc.ended) != 1 || proc.ended[0] != "Inner" {
+			t.Errorf("expected Inner to be ended first, got %v", proc.ended)
+		}
+		proc.mu.Unlock()
+		finish()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	tr := exp.next(t)
+	for _, s := range tr.Spans {
+		if s.Tags["pod"] != "pod-1" {
+			t.Errorf("expected span %q to carry default tag, got %v", s.Name, s.Tags)
+		}
+	}
+
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	want := []string{"Inner", "Outer", "GET /orders"}
+	if strings.Join(proc.ended, ",") != strings.Join(want, ",") {
+		t.Errorf("expected OnEnd order %v, got %v", want, proc.ended)
+	}
+}
+
+func TestSetTraceAttr(t *testing.T) {
+	exp := newChanExporter()
+	mw := NewMiddleware(
+		WithExporter(exp),
+		WithRedaction(RedactionConfig{KeyRules: []KeyRule{{Pattern: "user.email", Action: RedactMask}}}),
+	)
+
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, finish := StartSpan(r.Context(), "Load User")
+		defer finish()
+
+		// Discovered deep inside the handler, but describes the whole request
+		SetTraceAttr(ctx, "user.id", "user_123")
+		SetTraceAttr(ctx, "user.email", "jane@example.com")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	tr := exp.next(t)
+	if v, ok := tr.Attr("user.id"); !ok || v != "user_123" {
+		t.Errorf("expected user.id trace attribute, got %q", v)
+	}
+	if v, _ := tr.Attr("user.email"); v != RedactedValue {
+		t.Errorf("expected trace attributes to be redacted, got %q", v)
+	}
+	for _, s := range tr.Spans {
+		if _, ok := s.Tags["user.id"]; ok {
+			t.Errorf("trace attribute leaked into span %q tags", s.Name)
+		}
+	}
+
+	b, _ := json.Marshal(tr)
+	if !strings.Contains(string(b), `"attributes":{"user.email":"[REDACTED]","user.id":"user_123"}`) {
+		t.Errorf("expected attributes at trace level, got %s", b)
+	}
+
+	// Outside a trace it is a no-op
+	SetTraceAttr(context.Background(), "k", "v")
+}
+
+func TestAddEvent(t *testing.T) {
+	exp := newChanExporter()
+	tracer := NewTracer(
+		WithExporter(exp),
+		WithRedaction(RedactionConfig{KeyRules: []KeyRule{{Pattern: "card", Action: RedactDrop}}}),
+	)
+	ctx, end := tracer.StartTrace(context.Background(), "checkout")
+	ctx, finish := StartSpan(ctx, "Charge")
+	attrs := map[string]string{"attempt": "2", "card": "4111111111111111"}
+	AddEvent(ctx, "retry", attrs)
+	attrs["attempt"] = "3"
+	finish()
+	end()
+
+	tr := exp.next(t)
+	events := tr.Spans[1].Events
+	if len(events) != 1 || events[0].Name != "retry" || events[0].Time.IsZero() {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if got := events[0].Attributes; len(got) != 1 || got["attempt"] != "2" {
+		t.Errorf("expected a redacted copy of the attributes, got %v", got)
+	}
+	if len(tr.Root.Events) != 0 {
+		t.Errorf("event recorded on the wrong span: %+v", tr.Root.Events)
+	}
+
+	// Outside a trace it is a no-op
+	AddEvent(context.Background(), "retry", nil)
+}
+
+func TestTrace_AddSpan(t *testing.T) {
+	exp := newChanExporter()
+	tracer := NewTracer(WithExporter(exp))
+	ctx, end := tracer.StartTrace(context.Background(), "job")
+	tr, _ := TraceFromContext(ctx)
+
+	external := &Span{ID: "1111111111111111", ParentID: tr.Root.ID, Name: "external"}
+	if !tr.AddSpan(external) {
+		t.Error("expected the span to be added to the live trace")
+	}
+	end()
+	if tr.AddSpan(&Span{ID: "2222222222222222", Name: "late"}) {
+		t.Error("spans must not be added once the trace ended")
+	}
+
+	if got := exp.next(t); len(got.Spans) != 2 || got.Spans[1] != external {
+		t.Errorf("unexpected spans: %+v", got.Spans)
+	}
+}
+
+func TestTrace_EndedIsReadOnly(t *testing.T) {
+	exp := newChanExporter()
+	tracer := NewTracer(WithExporter(exp))
+	ctx, end := tracer.StartTrace(context.Background(), "job")
+	spanCtx, finish := StartSpan(ctx, "step")
+	end()
+
+	// Exporters may be reading the trace: late tags, events and span ends are ignored
+	AddTag(spanCtx, "late", "true")
+	AddTag(ctx, "late", "true")
+	AddEvent(spanCtx, "late", nil)
+	finish()
+
+	tr := exp.next(t)
+	for _, s := range tr.Spans {
+		if s.Tags["late"] != "" || len(s.Events) != 0 {
+			t.Errorf("span %s changed after the trace ended: %+v", s.Name, s)
+		}
+	}
+	if !tr.Spans[1].EndTime.IsZero() {
+		t.Errorf("expected the span to stay unfinished, got %v", tr.Spans[1].EndTime)
+	}
+}
+
+func TestConsoleExporter_Writer(t *testing.T) {
+	var buf bytes.Buffer
+	exp := &ConsoleExporter{Writer: &buf}
+	exp.Export(&Trace{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"})
+	exp.Export(&Trace{TraceID: "0af7651916cd43dd8448eb211c80319c"})
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `FLOW_LOG: {"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`) {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestAddTag_Typed(t *testing.T) {
+	exp := newChanExporter()
+	tracer := NewTracer(WithExporter(exp))
+	ctx, end := tracer.StartTrace(context.Background(), "job")
+	AddTagInt(ctx, "rows", 3)
+	AddTagFloat(ctx, "ratio", 0.5)
+	AddTagBool(ctx, "cached", true)
+	AddTag(ctx, "order.id", "12345")
+	// A plain AddTag replaces a typed tag with a string
+	AddTagInt(ctx, "status", 200)
+	AddTag(ctx, "status", "OK")
+	end()
+
+	root := exp.next(t).Root
+	want := map[string]any{"rows": int64(3), "ratio": 0.5, "cached": true, "order.id": "12345", "status": "OK"}
+	for k, v := range want {
+		if got := TypedValue(root.Tags[k], root.TagTypes[k]); got != v {
+			t.Errorf("tag %s: expected %#v, got %#v", k, v, got)
+		}
+	}
+	// Values that no longer parse, e.g. masked by redaction, fall back to strings
+	if got := TypedValue("****", TagTypeInt); got != "****" {
+		t.Errorf("expected the string back, got %#v", got)
+	}
+}
@@ -0,0 +1,218 @@
+package flowtracker
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+// ---------------------------------------------------------
+// Propagation (W3C "traceparent" & "baggage")
+// ---------------------------------------------------------
+
+const (
+	// TraceParentHeader is the W3C header carrying the trace and parent span IDs.
+	TraceParentHeader = "traceparent"
+)
+
+// newTraceID returns a random 128-bit W3C trace ID as 32 hex characters.
+func newTraceID() string {
+	hi, lo := rand.Uint64(), rand.Uint64()
+	for hi == 0 && lo == 0 {
+		lo = rand.Uint64()
+	}
+	return fmt.Sprintf("%016x%016x", hi, lo)
+}
+
+// newSpanID returns a random 64-bit W3C span ID as 16 hex characters.
+func newSpanID() string {
+	id := rand.Uint64()
+	for id == 0 {
+		id = rand.Uint64()
+	}
+	return fmt.Sprintf("%016x", id)
+}
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+// IsValid reports whether sc carries a well-formed, non-zero trace and span ID.
+func (sc SpanContext) IsValid() bool {
+	return isHexID(sc.TraceID, 32) && isHexID(sc.SpanID, 16)
+}
+
+// TraceParent renders sc as a W3C traceparent value, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+// FlowTracker records every request, so the sampled flag is always set.
+func (sc SpanContext) TraceParent() string {
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-01"
+}
+
+// ParseTraceParent parses a W3C traceparent value.
+func ParseTraceParent(v string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	// Version 00 has exactly four fields, future versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	sc := SpanContext{TraceID: parts[1], SpanID: parts[2]}
+	return sc, sc.IsValid()
+}
+
+// SpanContextFromContext returns the span context of the current span in ctx.
+// Without a local trace it falls back to the remote parent set by Extract or
+// ContextWithRemoteSpanContext. The result is invalid if neither exists.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if trace, ok := ctx.Value(traceKey).(*Trace); ok {
+		spanID, _ := ctx.Value(parentSpanKey).(string)
+		return SpanContext{TraceID: trace.TraceID, SpanID: spanID}
+	}
+	sc, _ := ctx.Value(remoteSpanKey).(SpanContext)
+	return sc
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx carrying sc as the remote parent.
+// The next Tracer.StartTrace on that context continues sc's trace.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanKey, sc)
+}
+
+// ContextBridge connects FlowTracker to another tracing API that keeps its active span
+// in the context, such as OpenTelemetry, so spans of both nest under each other.
+// The otel addon provides one.
+type ContextBridge interface {
+	// SpanContextFromContext returns the span active in ctx in the other API, if any.
+	SpanContextFromContext(ctx context.Context) (SpanContext, bool)
+	// ContextWithSpanContext returns a copy of ctx in which sc is the active span
+	// of the other API, so its spans started from ctx become children of sc.
+	ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context
+}
+
+// WithContextBridge makes StartTrace and StartSpan adopt the bridged API's active span
+// as parent, and makes every FlowTracker span the bridged API's active span.
+func WithContextBridge(b ContextBridge) Option {
+	return func(c *config) {
+		c.bridge = b
+	}
+}
+
+// bridgedSpanContext returns the valid span context active in ctx in the bridged API.
+func (c *config) bridgedSpanContext(ctx context.Context) (SpanContext, bool) {
+	if c == nil || c.bridge == nil {
+		return SpanContext{}, false
+	}
+	sc, ok := c.bridge.SpanContextFromContext(ctx)
+	return sc, ok && sc.IsValid()
+}
+
+// parentSpanContext returns the span a trace started with ctx continues. The active span
+// of a bridged API takes precedence over a remote parent, as it's a local descendant of it.
+func (c *config) parentSpanContext(ctx context.Context) SpanContext {
+	sc := SpanContextFromContext(ctx)
+	if bridged, ok := c.bridgedSpanContext(ctx); ok {
+		if _, local := ctx.Value(traceKey).(*Trace); !local || bridged.TraceID == sc.TraceID {
+			return bridged
+		}
+	}
+	return sc
+}
+
+// activate makes sc the active span of the bridged API in ctx.
+func (c *config) activate(ctx context.Context, sc SpanContext) context.Context {
+	if c == nil || c.bridge == nil {
+		return ctx
+	}
+	return c.bridge.ContextWithSpanContext(ctx, sc)
+}
+
+// Carrier is the key/value store a trace context travels in:
+// HTTP headers, gRPC metadata or message headers.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// HeaderCarrier adapts http.Header to the Carrier interface.
+type HeaderCarrier http.Header
+
+// Get returns all values of key joined with ",", as list headers like baggage may be split.
+func (h HeaderCarrier) Get(key string) string {
+	return strings.Join(http.Header(h).Values(key), ",")
+}
+
+func (h HeaderCarrier) Set(key, value string) {
+	http.Header(h).Set(key, value)
+}
+
+// Inject writes the current span context (traceparent) and baggage of ctx into the carrier.
+func Inject(ctx context.Context, c Carrier) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		c.Set(TraceParentHeader, sc.TraceParent())
+	}
+	if b, _ := ctx.Value(baggageKey).(baggage); len(b) > 0 {
+		c.Set(BaggageHeader, b.encode())
+	}
+}
+
+// Extract returns a copy of ctx carrying the remote parent and baggage found in the carrier.
+func Extract(ctx context.Context, c Carrier) context.Context {
+	if sc, ok := ParseTraceParent(c.Get(TraceParentHeader)); ok {
+		ctx = ContextWithRemoteSpanContext(ctx, sc)
+	}
+	if v := c.Get(BaggageHeader); v != "" {
+		for _, m := range parseBaggage(v) {
+			ctx = SetBaggage(ctx, m.key, m.value)
+		}
+	}
+	return ctx
+}
+
+// InjectHeaders writes the propagated context of ctx into outgoing request headers.
+func InjectHeaders(ctx context.Context, h http.Header) {
+	Inject(ctx, HeaderCarrier(h))
+}
+
+// ExtractHeaders returns a copy of ctx carrying the propagated context found in incoming
+// request headers. The middleware calls this for every request.
+func ExtractHeaders(ctx context.Context, h http.Header) context.Context {
+	return Extract(ctx, HeaderCarrier(h))
+}
+
+// Transport is an http.RoundTripper that injects the propagated context into every outgoing request.
+// Example: client := &http.Client{Transport: &flowtracker.Transport{}}
+type Transport struct {
+	// Base is the underlying RoundTripper. Default: http.DefaultTransport
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// RoundTrippers must not modify the original request
+	r = r.Clone(r.Context())
+	InjectHeaders(r.Context(), r.Header)
+	return base.RoundTrip(r)
+}
+
+func isHexID(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package flowtracker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"garbage", false},
+	}
+	for _, tt := range tests {
+		sc, ok := ParseTraceParent(tt.in)
+		if ok != tt.ok {
+			t.Errorf("ParseTraceParent(%q) ok = %v, want %v", tt.in, ok, tt.ok)
+		}
+		if ok && sc.TraceParent()[3:52] != tt.in[3:52] {
+			t.Errorf("round trip mismatch: %q vs %q", sc.TraceParent(), tt.in)
+		}
+	}
+}
+
+func TestNewIDs(t *testing.T) {
+	sc := SpanContext{TraceID: newTraceID(), SpanID: newSpanID()}
+	if !sc.IsValid() {
+		t.Errorf("generated IDs are not valid W3C IDs: %+v", sc)
+	}
+}
+
+func TestMiddleware_ContinuesRemoteTrace(t *testing.T) {
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	// Downstream service records the traceparent it receives
+	var received string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(TraceParentHeader)
+	}))
+	defer downstream.Close()
+
+	exp := newChanExporter()
+	mw := NewMiddleware(WithExporter(exp))
+	client := &http.Client{Transport: &Transport{}}
+
+	var callSpan SpanContext
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, finish := StartSpan(r.Context(), "HTTP: Downstream", WithSpanKind(SpanKindClient))
+		defer finish()
+		callSpan = SpanContextFromContext(ctx)
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("downstream call failed: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceParentHeader, parent)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	tr := exp.next(t)
+	if tr.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected remote trace ID to be kept, got %q", tr.TraceID)
+	}
+	if tr.RemoteParentID != "00f067aa0ba902b7" {
+		t.Errorf("expected remote parent to be recorded, got %q", tr.RemoteParentID)
+	}
+	if tr.Root.ParentID != "" || tr.Root.Kind != SpanKindServer {
+		t.Errorf("unexpected root span: %+v", tr.Root)
+	}
+	if tr.Spans[1].Kind != SpanKindClient {
+		t.Errorf("expected client span kind, got %q", tr.Spans[1].Kind)
+	}
+	if want := callSpan.TraceParent(); received != want || callSpan.TraceID != tr.TraceID {
+		t.Errorf("expected downstream traceparent %q, got %q", want, received)
+	}
+}
+
+func TestTracer_StartTrace(t *testing.T) {
+	exp := newChanExporter()
+	tracer := NewTracer(WithExporter(exp))
+
+	ctx, end := tracer.StartTrace(context.Background(), "job: nightly-report")
+	_, finish := StartSpan(ctx, "Render")
+	finish()
+	end()
+
+	tr := exp.next(t)
+	if tr.Root.Name != "job: nightly-report" || len(tr.Spans) != 2 {
+		t.Errorf("unexpected trace: root %q with %d spans", tr.Root.Name, len(tr.Spans))
+	}
+	if tr.RemoteParentID != "" {
+		t.Errorf("expected a fresh trace, got remote parent %q", tr.RemoteParentID)
+	}
+}
+
+// ctxBridge stands in for another tracing API keeping its active span in the context.
+type ctxBridge struct{}
+
+type bridgeKey struct{}
+
+func (ctxBridge) SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(bridgeKey{}).(SpanContext)
+	return sc, ok
+}
+
+func (ctxBridge) ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, bridgeKey{}, sc)
+}
+
+func TestContextBridge(t *testing.T) {
+	exp := newChanExporter()
+	tracer := NewTracer(WithExporter(exp), WithContextBridge(ctxBridge{}))
+	bridge := ctxBridge{}
+
+	// An active span of the other API wins over the remote parent it descends from
+	external := SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	ctx := ContextWithRemoteSpanContext(context.Background(), SpanContext{TraceID: external.TraceID, SpanID: "1111111111111111"})
+	ctx = bridge.ContextWithSpanContext(ctx, external)
+
+	ctx, end := tracer.StartTrace(ctx, "consume")
+	if sc, _ := bridge.SpanContextFromContext(ctx); sc != SpanContextFromContext(ctx) {
+		t.Errorf("the root span should be active in the other API, got %+v", sc)
+	}
+
+	// A span of the other API started below the root becomes the parent
+	child := SpanContext{TraceID: external.TraceID, SpanID: "2222222222222222"}
+	ctx, finish := StartSpan(bridge.ContextWithSpanContext(ctx, child), "nested")
+	if sc, _ := bridge.SpanContextFromContext(ctx); sc != SpanContextFromContext(ctx) {
+		t.Errorf("the new span should be active in the other API, got %+v", sc)
+	}
+	finish()
+
+	// Spans of another trace are ignored
+	_, finish = StartSpan(bridge.ContextWithSpanContext(ctx, SpanContext{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "3333333333333333"}), "unrelated")
+	finish()
+	end()
+
+	tr := exp.next(t)
+	if tr.TraceID != external.TraceID || tr.RemoteParentID != external.SpanID {
+		t.Errorf("expected the trace to continue %+v, got %s/%s", external, tr.TraceID, tr.RemoteParentID)
+	}
+	if tr.Spans[1].ParentID != child.SpanID {
+		t.Errorf("expected parent %s, got %s", child.SpanID, tr.Spans[1].ParentID)
+	}
+	if tr.Spans[2].ParentID != tr.Spans[1].ID {
+		t.Errorf("expected parent %s, got %s", tr.Spans[1].ID, tr.Spans[2].ParentID)
+	}
+}
@@ -0,0 +1,291 @@
+package flowtracker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ---------------------------------------------------------
+// Redaction (PII scrubbing before export)
+// ---------------------------------------------------------
+
+// RedactedValue is the placeholder written in place of masked data.
+const RedactedValue = "[REDACTED]"
+
+// RedactAction defines what happens to a tag whose key matches a KeyRule.
+type RedactAction int
+
+const (
+	// RedactDrop removes the tag from the span entirely.
+	RedactDrop RedactAction = iota
+	// RedactMask replaces the tag value with RedactedValue.
+	RedactMask
+	// RedactHash replaces the tag value with a salted SHA-256 digest, so equal
+	// identifiers can still be correlated across traces without being exposed.
+	RedactHash
+)
+
+// KeyRule applies an action to every tag whose key matches Pattern.
+type KeyRule struct {
+	// Pattern is a glob (see path.Match) matched case-insensitively against the tag key.
+	// Example: "*password*", "user.email", "http.header.*"
+	Pattern string
+	Action  RedactAction
+}
+
+// ValueRule rewrites every part of a tag value matching Pattern.
+type ValueRule struct {
+	// Name identifies the rule, it is only used for readability.
+	Name    string
+	Pattern *regexp.Regexp
+	// Replacement is written for each match. Defaults to RedactedValue.
+	Replacement string
+	// Validate optionally confirms a match before it is replaced (e.g. a Luhn check),
+	// which keeps the rule from eating timestamps or order numbers.
+	Validate func(match string) bool
+}
+
+var (
+	// EmailRule masks e-mail addresses.
+	EmailRule = ValueRule{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	}
+
+	// CardNumberRule masks payment card numbers (PANs), optionally separated by spaces or dashes.
+	CardNumberRule = ValueRule{
+		Name:     "pan",
+		Pattern:  regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Validate: luhnValid,
+	}
+
+	// JWTRule masks JSON Web Tokens.
+	JWTRule = ValueRule{
+		Name:    "jwt",
+		Pattern: regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`),
+	}
+)
+
+// DefaultValueRules returns the built-in rules for e-mails, card numbers and JWTs.
+func DefaultValueRules() []ValueRule {
+	return []ValueRule{EmailRule, CardNumberRule, JWTRule}
+}
+
+// RedactionConfig describes how span tags and trace attributes are scrubbed before any exporter sees them.
+type RedactionConfig struct {
+	// KeyRules are evaluated in order; the first matching rule decides the tag's fate
+	// and no further processing is done on it.
+	KeyRules []KeyRule
+
+	// ValueRules are applied to every remaining tag value.
+	// Example: flowtracker.DefaultValueRules()
+	ValueRules []ValueRule
+
+	// NormalizeSQL replaces literals in SQL tags with '?' (see NormalizeSQL).
+	NormalizeSQL bool
+
+	// SQLKeys lists the tag keys holding SQL statements. Default: []string{"db.query"}
+	SQLKeys []string
+
+	// HashSalt is mixed into RedactHash digests. Set it to make digests
+	// unguessable for low-entropy identifiers.
+	HashSalt string
+}
+
+// WithRedaction scrubs span tags once, before the trace is handed to the exporters,
+// so every exporter receives the same redacted data.
+func WithRedaction(rc RedactionConfig) Option {
+	return func(c *config) {
+		c.redactor = newRedactor(rc)
+	}
+}
+
+type redactor struct {
+	keyRules   []KeyRule
+	valueRules []ValueRule
+	sqlKeys    map[string]bool
+	salt       string
+}
+
+func newRedactor(rc RedactionConfig) *redactor {
+	r := &redactor{
+		valueRules: rc.ValueRules,
+		salt:       rc.HashSalt,
+	}
+	for _, kr := range rc.KeyRules {
+		r.keyRules = append(r.keyRules, KeyRule{Pattern: strings.ToLower(kr.Pattern), Action: kr.Action})
+	}
+	if rc.NormalizeSQL {
+		keys := rc.SQLKeys
+		if len(keys) == 0 {
+			keys = []string{"db.query"}
+		}
+		r.sqlKeys = make(map[string]bool, len(keys))
+		for _, k := range keys {
+			r.sqlKeys[k] = true
+		}
+	}
+	return r
+}
+
+// redactTrace scrubs the trace attributes and the tags and event attributes of every span in place.
+func (r *redactor) redactTrace(tr *Trace) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	r.redactTags(tr.Attributes)
+	for _, s := range tr.Spans {
+		r.redactTags(s.Tags)
+		for _, e := range s.Events {
+			r.redactTags(e.Attributes)
+		}
+	}
+}
+
+func (r *redactor) redactTags(tags map[string]string) {
+	for k, v := range tags {
+		if action, ok := r.matchKey(k); ok {
+			switch action {
+			case RedactDrop:
+				delete(tags, k)
+			case RedactMask:
+				tags[k] = RedactedValue
+			case RedactHash:
+				tags[k] = r.hash(v)
+			}
+			continue
+		}
+		if r.sqlKeys[k] {
+			v = NormalizeSQL(v)
+		}
+		tags[k] = r.redactValue(v)
+	}
+}
+
+func (r *redactor) matchKey(key string) (RedactAction, bool) {
+	key = strings.ToLower(key)
+	for _, kr := range r.keyRules {
+		if ok, _ := path.Match(kr.Pattern, key); ok {
+			return kr.Action, true
+		}
+	}
+	return 0, false
+}
+
+func (r *redactor) redactValue(v string) string {
+	for _, vr := range r.valueRules {
+		if vr.Pattern == nil {
+			continue
+		}
+		replacement := vr.Replacement
+		if replacement == "" {
+			replacement = RedactedValue
+		}
+		v = vr.Pattern.ReplaceAllStringFunc(v, func(m string) string {
+			if vr.Validate != nil && !vr.Validate(m) {
+				return m
+			}
+			return replacement
+		})
+	}
+	return v
+}
+
+func (r *redactor) hash(v string) string {
+	sum := sha256.Sum256([]byte(r.salt + v))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
+
+// NormalizeSQL replaces string and numeric literals in a SQL statement with '?'
+// and collapses whitespace, so the statement no longer carries user data and
+// identical queries group together.
+//
+// Example: "SELECT * FROM users WHERE email = 'a@b.c' AND id = 42"
+// becomes  "SELECT * FROM users WHERE email = ? AND id = ?"
+func NormalizeSQL(query string) string {
+	var sb strings.Builder
+	sb.Grow(len(query))
+
+	isIdent := func(c rune) bool {
+		return c == '_' || c == '$' || c == '.' || unicode.IsLetter(c) || unicode.IsDigit(c)
+	}
+
+	rs := []rune(query)
+	var prev rune
+	space := false
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		switch {
+		case unicode.IsSpace(c):
+			space = true
+			prev = c
+			continue
+		case c == '\'':
+			// String literal, '' is an escaped quote
+			for i++; i < len(rs); i++ {
+				if rs[i] == '\'' {
+					if i+1 < len(rs) && rs[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			c = '?'
+		case c == '"' || c == '`':
+			// Quoted identifier, keep as is
+			start := i
+			for i++; i < len(rs) && rs[i] != c; i++ {
+			}
+			if i >= len(rs) {
+				i = len(rs) - 1
+			}
+			if space && sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			space = false
+			sb.WriteString(string(rs[start : i+1]))
+			prev = c
+			continue
+		case unicode.IsDigit(c) && !isIdent(prev):
+			// Numeric literal: 42, 3.14, 1e10, 0x1F
+			for i+1 < len(rs) && (isIdent(rs[i+1]) ||
+				((rs[i+1] == '+' || rs[i+1] == '-') && (rs[i] == 'e' || rs[i] == 'E'))) {
+				i++
+			}
+			c = '?'
+		}
+		if space && sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		space = false
+		sb.WriteRune(c)
+		prev = c
+	}
+	return sb.String()
+}
@@ -0,0 +1,147 @@
+package flowtracker
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+)
+
+// ---------------------------------------------------------
+// Resource (which service produced the trace)
+// ---------------------------------------------------------
+
+// Resource describes the service that produced a trace.
+// It is attached to every exported trace, so traces from many services
+// can share one Kafka topic or log stream.
+type Resource struct {
+	ServiceName    string            `json:"service_name,omitempty"`
+	ServiceVersion string            `json:"service_version,omitempty"`
+	Environment    string            `json:"environment,omitempty"`
+	Host           string            `json:"host,omitempty"`
+	Pod            string            `json:"pod,omitempty"`
+	Attributes     map[string]string `json:"attributes,omitempty"`
+}
+
+// WithResource sets the service resource attached to every trace.
+// Non-empty fields override the values found by DetectResource.
+func WithResource(r Resource) Option {
+	return func(c *config) {
+		c.resource = &r
+	}
+}
+
+// DetectResource builds a Resource from the environment:
+//   - OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES (service.name, service.version,
+//     deployment.environment, host.name, k8s.pod.name, anything else goes to Attributes)
+//   - the hostname, and POD_NAME as set by the Kubernetes downward API
+//   - the build info of the running binary for the service name and version
+func DetectResource() Resource {
+	r := Resource{}
+
+	attrs := parseResourceAttributes(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	take := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := attrs[k]; ok {
+				delete(attrs, k)
+				return v
+			}
+		}
+		return ""
+	}
+	r.ServiceName = take("service.name")
+	r.ServiceVersion = take("service.version")
+	r.Environment = take("deployment.environment.name", "deployment.environment")
+	r.Host = take("host.name")
+	r.Pod = take("k8s.pod.name")
+	if len(attrs) > 0 {
+		r.Attributes = attrs
+	}
+
+	if v := os.Getenv("OTEL_SERVICE_NAME"); v != "" {
+		r.ServiceName = v
+	}
+	if r.Host == "" {
+		r.Host, _ = os.Hostname()
+	}
+	if r.Pod == "" {
+		r.Pod = os.Getenv("POD_NAME")
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if r.ServiceName == "" && info.Path != "" {
+			r.ServiceName = filepath.Base(info.Path)
+		}
+		if r.ServiceVersion == "" {
+			r.ServiceVersion = buildVersion(info)
+		}
+	}
+	if r.ServiceName == "" && len(os.Args) > 0 {
+		r.ServiceName = filepath.Base(os.Args[0])
+	}
+	return r
+}
+
+// merge returns r with every non-empty field of override applied on top.
+func (r Resource) merge(override *Resource) Resource {
+	if override == nil {
+		return r
+	}
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&r.ServiceName, override.ServiceName)
+	set(&r.ServiceVersion, override.ServiceVersion)
+	set(&r.Environment, override.Environment)
+	set(&r.Host, override.Host)
+	set(&r.Pod, override.Pod)
+	if len(override.Attributes) > 0 {
+		attrs := make(map[string]string, len(r.Attributes)+len(override.Attributes))
+		for k, v := range r.Attributes {
+			attrs[k] = v
+		}
+		for k, v := range override.Attributes {
+			attrs[k] = v
+		}
+		r.Attributes = attrs
+	}
+	return r
+}
+
+// buildVersion prefers the module version and falls back to the VCS revision.
+func buildVersion(info *debug.BuildInfo) string {
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			if len(s.Value) > 12 {
+				return s.Value[:12]
+			}
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// parseResourceAttributes decodes the "k1=v1,k2=v2" format of OTEL_RESOURCE_ATTRIBUTES.
+func parseResourceAttributes(s string) map[string]string {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		k = strings.TrimSpace(k)
+		if uv, err := url.PathUnescape(strings.TrimSpace(v)); err == nil {
+			v = uv
+		}
+		if k != "" {
+			out[k] = v
+		}
+	}
+	return out
+}
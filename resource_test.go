@@ -0,0 +1,52 @@
+package flowtracker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDetectResource_Env(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", "checkout")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "service.name=ignored,service.version=1.4.2,deployment.environment=prod,k8s.pod.name=checkout-7d9f,team=payments")
+
+	r := DetectResource()
+	if r.ServiceName != "checkout" {
+		t.Errorf("OTEL_SERVICE_NAME should win, got %q", r.ServiceName)
+	}
+	if r.ServiceVersion != "1.4.2" || r.Environment != "prod" || r.Pod != "checkout-7d9f" {
+		t.Errorf("unexpected resource: %+v", r)
+	}
+	if r.Attributes["team"] != "payments" || len(r.Attributes) != 1 {
+		t.Errorf("expected remaining attributes to be kept, got %v", r.Attributes)
+	}
+	if host, _ := os.Hostname(); r.Host != host {
+		t.Errorf("expected host %q, got %q", host, r.Host)
+	}
+}
+
+func TestMiddleware_WithResource(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", "detected")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=staging")
+
+	exp := newChanExporter()
+	mw := NewMiddleware(WithExporter(exp), WithResource(Resource{ServiceName: "orders", ServiceVersion: "v2"}))
+	mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	tr := exp.next(t)
+	if tr.Resource == nil {
+		t.Fatal("expected resource on trace")
+	}
+	if tr.Resource.ServiceName != "orders" || tr.Resource.ServiceVersion != "v2" || tr.Resource.Environment != "staging" {
+		t.Errorf("expected user values merged over detected ones, got %+v", tr.Resource)
+	}
+
+	b, _ := json.Marshal(tr)
+	if !strings.Contains(string(b), `"resource":{"service_name":"orders","service_version":"v2","environment":"staging"`) {
+		t.Errorf("unexpected trace JSON: %s", b)
+	}
+}
@@ -0,0 +1,125 @@
+package sqltrace
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// ---------------------------------------------------------
+// sqlcommenter (https://google.github.io/sqlcommenter/spec/)
+// ---------------------------------------------------------
+
+// CommentField is one key='value' pair of a sqlcommenter comment.
+// Fields whose Value returns "" are left out.
+type CommentField struct {
+	Key   string
+	Value func(ctx context.Context) string
+}
+
+// TraceParentField adds the W3C traceparent of the current span,
+// which links a statement in the slow query log back to the request.
+func TraceParentField() CommentField {
+	return CommentField{Key: "traceparent", Value: func(ctx context.Context) string {
+		if sc := flowtracker.SpanContextFromContext(ctx); sc.IsValid() {
+			return sc.TraceParent()
+		}
+		return ""
+	}}
+}
+
+// RouteField adds the name of the trace's root span, e.g. "GET /orders".
+func RouteField() CommentField {
+	return CommentField{Key: "route", Value: func(ctx context.Context) string {
+		if tr, ok := flowtracker.TraceFromContext(ctx); ok && tr.Root != nil {
+			return tr.Root.Name
+		}
+		return ""
+	}}
+}
+
+// StaticField adds a fixed value, e.g. StaticField("application", "checkout").
+func StaticField(key, value string) CommentField {
+	return CommentField{Key: key, Value: func(context.Context) string { return value }}
+}
+
+// WithSQLCommenter appends a sqlcommenter comment to every statement sent to the driver:
+//
+//	SELECT * FROM users /*route='GET%20%2Fusers',traceparent='00-...-01'*/
+//
+// Without fields it adds TraceParentField and RouteField. Statements are only
+// commented inside a trace, and never if they already end in a comment or carry a traceparent.
+// The db.query tag keeps the statement without the comment.
+//
+// Prepared statements are commented once, when they are prepared: their traceparent
+// points to the "DB: Prepare" span. database/sql prepares statements for a single call
+// when the driver can't execute a query directly, so those point to the right request,
+// but a statement from db.Prepare keeps the comment of the request that prepared it.
+func WithSQLCommenter(fields ...CommentField) Option {
+	if len(fields) == 0 {
+		fields = []CommentField{TraceParentField(), RouteField()}
+	}
+	return func(c *config) {
+		c.commentFields = fields
+	}
+}
+
+// comment appends the configured comment to query, if enabled.
+func (c *config) comment(ctx context.Context, query string) string {
+	if len(c.commentFields) == 0 {
+		return query
+	}
+	if _, ok := flowtracker.TraceFromContext(ctx); !ok {
+		return query
+	}
+	return AppendComment(ctx, query, c.commentFields...)
+}
+
+// AppendComment returns query with a sqlcommenter comment built from fields, for
+// statements that don't go through a wrapped driver. Keys and values are URL-encoded
+// and quotes escaped, so no value can terminate the comment.
+// The query is returned unchanged if it already ends in a comment, or carries a
+// traceparent from another sqlcommenter.
+func AppendComment(ctx context.Context, query string, fields ...CommentField) string {
+	if strings.HasSuffix(strings.TrimRight(query, " \t\n;"), "*/") || strings.Contains(query, "traceparent=") {
+		return query
+	}
+
+	pairs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f.Value == nil {
+			continue
+		}
+		v := f.Value(ctx)
+		if f.Key == "" || v == "" {
+			continue
+		}
+		pairs = append(pairs, escapeComment(f.Key)+"='"+escapeComment(v)+"'")
+	}
+	if len(pairs) == 0 {
+		return query
+	}
+	// The spec requires the pairs to be sorted by key
+	sort.Strings(pairs)
+
+	query = strings.TrimRight(query, " \t\n")
+	suffix := ""
+	if strings.HasSuffix(query, ";") {
+		query, suffix = strings.TrimSuffix(query, ";"), ";"
+	}
+	// A "--" on the last line may start a line comment, which would swallow ours
+	sep := " "
+	if strings.Contains(query[strings.LastIndex(query, "\n")+1:], "--") {
+		sep = "\n"
+	}
+	return query + sep + "/*" + strings.Join(pairs, ",") + "*/" + suffix
+}
+
+// escapeComment URL-encodes s and then escapes single quotes, as the spec requires.
+func escapeComment(s string) string {
+	s = url.PathEscape(s)
+	return strings.ReplaceAll(s, "'", `\'`)
+}
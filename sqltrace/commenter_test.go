@@ -0,0 +1,125 @@
+package sqltrace
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+func TestWithSQLCommenter(t *testing.T) {
+	drv := &fakeDriver{}
+	db := OpenDB(fakeConnector{drv: drv}, WithSQLCommenter(TraceParentField(), RouteField(), StaticField("application", "it's*/checkout")))
+	defer db.Close()
+
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp))
+	ctx, end := tracer.StartTrace(context.Background(), "GET /orders")
+
+	if _, err := db.ExecContext(ctx, "UPDATE orders SET state = 'paid' WHERE id = 7;"); err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "SELECT 1 /* already commented */"); err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	end()
+	tr := exp.next(t)
+
+	// The statement is prepared inside the "DB: Prepare" span, which is what the traceparent points to
+	prepare := tr.Spans[1]
+	want := "UPDATE orders SET state = 'paid' WHERE id = 7 /*" +
+		`application='it%27s%2A%2Fcheckout',` +
+		`route='GET%20%2Forders',` +
+		"traceparent='00-" + tr.TraceID + "-" + prepare.ID + "-01'*/;"
+	if drv.queries[0] != want {
+		t.Errorf("unexpected commented statement\n got: %s\nwant: %s", drv.queries[0], want)
+	}
+	if drv.queries[1] != "SELECT 1 /* already commented */" {
+		t.Errorf("statement with a comment must not be changed, got %s", drv.queries[1])
+	}
+	if got := prepare.Tags["db.query"]; strings.Contains(got, "/*") {
+		t.Errorf("db.query should not carry the comment, got %q", got)
+	}
+}
+
+func TestWithSQLCommenter_Defaults(t *testing.T) {
+	drv := &fakeDriver{}
+	db := OpenDB(fakeConnector{drv: drv}, WithSQLCommenter())
+	defer db.Close()
+
+	// Outside a trace, statements are left alone
+	db.ExecContext(context.Background(), "DELETE FROM sessions")
+
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp))
+	ctx, end := tracer.StartTrace(context.Background(), "job")
+	db.ExecContext(ctx, "DELETE FROM sessions")
+	end()
+	exp.next(t)
+
+	if drv.queries[0] != "DELETE FROM sessions" {
+		t.Errorf("expected untouched statement outside a trace, got %s", drv.queries[0])
+	}
+	re := regexp.MustCompile(`^DELETE FROM sessions /\*route='job',traceparent='00-[0-9a-f]{32}-[0-9a-f]{16}-01'\*/$`)
+	if !re.MatchString(drv.queries[1]) {
+		t.Errorf("unexpected commented statement: %s", drv.queries[1])
+	}
+}
+
+func TestAppendComment(t *testing.T) {
+	fields := []CommentField{StaticField("application", "checkout")}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// Optimizer hints or "--" inside the statement don't stop the comment
+		{"SELECT /*+ INDEX(o idx_state) */ * FROM orders", "SELECT /*+ INDEX(o idx_state) */ * FROM orders /*application='checkout'*/"},
+		{"SELECT * FROM notes WHERE body = '--'\nLIMIT 1", "SELECT * FROM notes WHERE body = '--'\nLIMIT 1 /*application='checkout'*/"},
+		// A "--" on the last line may start a line comment, so it goes on a new line
+		{"SELECT * FROM notes WHERE body = '--'", "SELECT * FROM notes WHERE body = '--'\n/*application='checkout'*/"},
+		{"SELECT 1 -- health check", "SELECT 1 -- health check\n/*application='checkout'*/"},
+		{"SELECT 1; -- health check\n", "SELECT 1; -- health check\n/*application='checkout'*/"},
+		// Statements ending in a comment or already carrying a traceparent are left alone
+		{"SELECT 1 /* already commented */;", "SELECT 1 /* already commented */;"},
+		{"SELECT 1 /*traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'*/ FOR UPDATE", "SELECT 1 /*traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'*/ FOR UPDATE"},
+	}
+	for _, tt := range tests {
+		if got := AppendComment(context.Background(), tt.query, fields...); got != tt.want {
+			t.Errorf("AppendComment(%q)\n got: %q\nwant: %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestWithSQLCommenter_PreparedStatement(t *testing.T) {
+	drv := &fakeDriver{}
+	db := OpenDB(fakeConnector{drv: drv}, WithSQLCommenter(TraceParentField()))
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	exp := make(chanExporter, 2)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp))
+	ctx, end := tracer.StartTrace(context.Background(), "startup")
+	stmt, err := db.PrepareContext(ctx, "SELECT name FROM users WHERE id = ?")
+	if err != nil {
+		t.Fatalf("prepare failed: %v", err)
+	}
+	defer stmt.Close()
+	end()
+	prepared := exp.next(t)
+
+	// The statement is reused by a later request without being prepared again
+	ctx, end = tracer.StartTrace(context.Background(), "GET /users")
+	if _, err := stmt.ExecContext(ctx, 7); err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	end()
+	exp.next(t)
+
+	// Its comment still points to the Prepare span of the first trace
+	want := "SELECT name FROM users WHERE id = ? /*traceparent='00-" + prepared.TraceID + "-" + prepared.Spans[1].ID + "-01'*/"
+	if len(drv.queries) != 1 || drv.queries[0] != want {
+		t.Errorf("unexpected statements reached the driver: %v\nwant: %s", drv.queries, want)
+	}
+}
@@ -0,0 +1,483 @@
+// Package sqltrace wraps database/sql drivers so every statement run inside a
+// FlowTracker trace gets its own span, instead of a hand-written StartSpan and
+// AddTag(ctx, "db.query", ...) around each call.
+//
+// Only the context variants (ExecContext, QueryContext, PrepareContext, BeginTx, ...)
+// can be linked to a trace, since the context is what carries it.
+package sqltrace
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// ---------------------------------------------------------
+// Configuration Options
+// ---------------------------------------------------------
+
+type config struct {
+	system        string
+	rawQuery      bool
+	commentFields []CommentField
+}
+
+type Option func(*config)
+
+// WithDBSystem tags every span with db.system, e.g. "postgresql" or "mysql".
+func WithDBSystem(system string) Option {
+	return func(c *config) {
+		c.system = system
+	}
+}
+
+// WithRawQuery records statements as they are, instead of normalized with
+// flowtracker.NormalizeSQL. Only use it when statements never contain literals.
+func WithRawQuery() Option {
+	return func(c *config) {
+		c.rawQuery = true
+	}
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// ---------------------------------------------------------
+// Entry Points
+// ---------------------------------------------------------
+
+// Register registers a traced wrapper of the driver registered under driverName and
+// returns the name of the wrapper, to be used with sql.Open.
+//
+// Example:
+//
+//	name, err := sqltrace.Register("postgres", sqltrace.WithDBSystem("postgresql"))
+//	db, err := sql.Open(name, dsn)
+func Register(driverName string, opts ...Option) (string, error) {
+	// sql.Open doesn't connect, it only resolves the driver
+	db, err := sql.Open(driverName, "")
+	if err != nil {
+		return "", fmt.Errorf("sqltrace: %w", err)
+	}
+	drv := db.Driver()
+	db.Close()
+
+	name := driverName + "-flowtracker"
+	for i := 1; isRegistered(name); i++ {
+		name = fmt.Sprintf("%s-flowtracker-%d", driverName, i)
+	}
+	sql.Register(name, Wrap(drv, opts...))
+	return name, nil
+}
+
+// OpenDB opens a database through a traced wrapper of the connector.
+func OpenDB(c driver.Connector, opts ...Option) *sql.DB {
+	return sql.OpenDB(WrapConnector(c, opts...))
+}
+
+// Wrap returns a driver that traces the statements of drv.
+func Wrap(drv driver.Driver, opts ...Option) driver.Driver {
+	return &tracedDriver{Driver: drv, cfg: newConfig(opts)}
+}
+
+// WrapConnector returns a connector that traces the statements of c.
+func WrapConnector(c driver.Connector, opts ...Option) driver.Connector {
+	cfg := newConfig(opts)
+	return &tracedConnector{Connector: c, drv: &tracedDriver{Driver: c.Driver(), cfg: cfg}, cfg: cfg}
+}
+
+func isRegistered(name string) bool {
+	for _, d := range sql.Drivers() {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ---------------------------------------------------------
+// Spans
+// ---------------------------------------------------------
+
+// span is a started database span.
+type span struct {
+	ctx    context.Context
+	finish func()
+}
+
+// start opens a "DB: <op>" client span tagged with the (normalized) statement.
+func (c *config) start(ctx context.Context, op, query string) span {
+	ctx, finish := flowtracker.StartSpan(ctx, "DB: "+op, flowtracker.WithSpanKind(flowtracker.SpanKindClient))
+	if c.system != "" {
+		flowtracker.AddTag(ctx, "db.system", c.system)
+	}
+	if query != "" {
+		if !c.rawQuery {
+			query = flowtracker.NormalizeSQL(query)
+		}
+		flowtracker.AddTag(ctx, "db.query", query)
+		if fields := strings.Fields(query); len(fields) > 0 {
+			flowtracker.AddTag(ctx, "db.operation", strings.ToUpper(fields[0]))
+		}
+	}
+	return span{ctx: ctx, finish: finish}
+}
+
+// end records err (if any) and finishes the span.
+// driver.ErrSkip is not an error, it asks database/sql to take a fallback path.
+func (s span) end(err error) {
+	if err != nil && !errors.Is(err, driver.ErrSkip) {
+		flowtracker.AddTag(s.ctx, "error", "true")
+		flowtracker.AddTag(s.ctx, "error.message", err.Error())
+	}
+	s.finish()
+}
+
+func (s span) endResult(res driver.Result, err error) {
+	if err == nil && res != nil {
+		if n, rerr := res.RowsAffected(); rerr == nil {
+			flowtracker.AddTagInt(s.ctx, "db.rows_affected", n)
+		}
+	}
+	s.end(err)
+}
+
+// endRows ends the span once rows are closed, so it covers reading the results.
+func (s span) endRows(rows driver.Rows, err error) (driver.Rows, error) {
+	if err != nil || rows == nil {
+		s.end(err)
+		return rows, err
+	}
+	return &tracedRows{Rows: rows, span: s}, nil
+}
+
+// ---------------------------------------------------------
+// Driver & Connector
+// ---------------------------------------------------------
+
+type tracedDriver struct {
+	driver.Driver
+	cfg *config
+}
+
+func (d *tracedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn, cfg: d.cfg}, nil
+}
+
+func (d *tracedDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.Driver.(driver.DriverContext); ok {
+		c, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &tracedConnector{Connector: c, drv: d, cfg: d.cfg}, nil
+	}
+	return &dsnConnector{name: name, drv: d}, nil
+}
+
+type tracedConnector struct {
+	driver.Connector
+	drv *tracedDriver
+	cfg *config
+}
+
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn, cfg: c.cfg}, nil
+}
+
+func (c *tracedConnector) Driver() driver.Driver {
+	return c.drv
+}
+
+// dsnConnector is used for drivers that don't implement driver.DriverContext.
+type dsnConnector struct {
+	name string
+	drv  *tracedDriver
+}
+
+func (c *dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.drv.Open(c.name)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.drv
+}
+
+// ---------------------------------------------------------
+// Conn
+// ---------------------------------------------------------
+
+type tracedConn struct {
+	driver.Conn
+	cfg *config
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	s := c.cfg.start(ctx, "Prepare", query)
+	commented := c.cfg.comment(s.ctx, query)
+
+	var stmt driver.Stmt
+	var err error
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = pc.PrepareContext(ctx, commented)
+	} else {
+		stmt, err = c.Conn.Prepare(commented)
+	}
+	s.end(err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{Stmt: stmt, query: query, cfg: c.cfg}, nil
+}
+
+func (c *tracedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	s := c.cfg.start(ctx, "Begin", "")
+
+	var tx driver.Tx
+	var err error
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = bc.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	s.end(err)
+	if err != nil {
+		return nil, err
+	}
+	// Commit and Rollback don't take a context, keep the one the transaction began with
+	return &tracedTx{Tx: tx, ctx: ctx, cfg: c.cfg}, nil
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	s := c.cfg.start(ctx, "Exec", query)
+	res, err := ec.ExecContext(ctx, c.cfg.comment(s.ctx, query), args)
+	s.endResult(res, err)
+	return res, err
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	s := c.cfg.start(ctx, "Query", query)
+	rows, err := qc.QueryContext(ctx, c.cfg.comment(s.ctx, query), args)
+	return s.endRows(rows, err)
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *tracedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// ---------------------------------------------------------
+// Stmt & Tx
+// ---------------------------------------------------------
+
+type tracedStmt struct {
+	driver.Stmt
+	query string
+	cfg   *config
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	sp := s.cfg.start(ctx, "Exec", s.query)
+
+	var res driver.Result
+	var err error
+	if ec, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = ec.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedToValues(args); err == nil {
+			res, err = s.Stmt.Exec(values)
+		}
+	}
+	sp.endResult(res, err)
+	return res, err
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	sp := s.cfg.start(ctx, "Query", s.query)
+
+	var rows driver.Rows
+	var err error
+	if qc, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = qc.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedToValues(args); err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	}
+	return sp.endRows(rows, err)
+}
+
+func (s *tracedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type tracedTx struct {
+	driver.Tx
+	ctx context.Context
+	cfg *config
+}
+
+func (t *tracedTx) Commit() error {
+	s := t.cfg.start(t.ctx, "Commit", "")
+	err := t.Tx.Commit()
+	s.end(err)
+	return err
+}
+
+func (t *tracedTx) Rollback() error {
+	s := t.cfg.start(t.ctx, "Rollback", "")
+	err := t.Tx.Rollback()
+	s.end(err)
+	return err
+}
+
+func namedToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		if a.Name != "" {
+			return nil, errors.New("sqltrace: driver does not support named parameters")
+		}
+		values[i] = a.Value
+	}
+	return values, nil
+}
+
+// ---------------------------------------------------------
+// Rows
+// ---------------------------------------------------------
+
+// tracedRows ends the Query span when database/sql closes the rows, and records the
+// error that stopped the iteration, if any. The optional driver.Rows interfaces are
+// forwarded, with the defaults database/sql uses when a driver doesn't implement them.
+type tracedRows struct {
+	driver.Rows
+	span span
+	err  error
+}
+
+func (r *tracedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+	if r.err != nil {
+		r.span.end(r.err)
+	} else {
+		r.span.end(err)
+	}
+	return err
+}
+
+func (r *tracedRows) HasNextResultSet() bool {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *tracedRows) NextResultSet() error {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *tracedRows) ColumnTypeScanType(index int) reflect.Type {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return ct.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+func (r *tracedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return ct.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *tracedRows) ColumnTypeLength(index int) (int64, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return ct.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *tracedRows) ColumnTypeNullable(index int) (bool, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return ct.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *tracedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return ct.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
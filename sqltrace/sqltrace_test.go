@@ -0,0 +1,274 @@
+package sqltrace
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spdeepak/flowtracker"
+)
+
+// ---------------------------------------------------------
+// Fake in-memory driver
+// ---------------------------------------------------------
+
+// fakeDriver only implements the legacy (non-context) interfaces, so the wrapper's
+// fallbacks are exercised. Statements containing "FAIL" return an error.
+type fakeDriver struct {
+	// queries records the statements the driver received
+	queries []string
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{drv: d}, nil
+}
+
+type fakeConn struct {
+	drv *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if strings.Contains(query, "FAIL PREPARE") {
+		return nil, errors.New("syntax error")
+	}
+	c.drv.queries = append(c.drv.queries, query)
+	return &fakeStmt{query: query}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeStmt struct {
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.Contains(s.query, "FAIL") {
+		return nil, errors.New("duplicate key")
+	}
+	return driver.RowsAffected(3), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows := &fakeRows{values: []string{"jane", "john"}}
+	if strings.Contains(s.query, "FAIL ROWS") {
+		rows.err = errors.New("connection reset")
+	}
+	return rows, nil
+}
+
+// fakeRows returns err instead of io.EOF after the values, if set.
+type fakeRows struct {
+	values []string
+	i      int
+	err    error
+}
+
+func (r *fakeRows) Columns() []string { return []string{"name"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.values) {
+		if r.err != nil {
+			return r.err
+		}
+		return io.EOF
+	}
+	dest[0] = r.values[r.i]
+	r.i++
+	return nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeConnector struct {
+	drv *fakeDriver
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return c.drv.Open("") }
+func (c fakeConnector) Driver() driver.Driver                        { return c.drv }
+
+// ---------------------------------------------------------
+// Tests
+// ---------------------------------------------------------
+
+type chanExporter chan *flowtracker.Trace
+
+func (c chanExporter) Export(tr *flowtracker.Trace) {
+	c <- tr
+}
+
+func (c chanExporter) next(t *testing.T) *flowtracker.Trace {
+	t.Helper()
+	select {
+	case tr := <-c:
+		return tr
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for exported trace")
+		return nil
+	}
+}
+
+func TestRegister_SpansPerStatement(t *testing.T) {
+	sql.Register("fake", &fakeDriver{})
+	name, err := Register("fake", WithDBSystem("fakedb"))
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer db.Close()
+
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp))
+	ctx, end := tracer.StartTrace(context.Background(), "GET /users")
+
+	res, err := db.ExecContext(ctx, "UPDATE users SET email = 'jane@example.com' WHERE id = 7")
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Errorf("expected 3 rows affected, got %d", n)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT name FROM users WHERE id > ?", 1)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	var names []string
+	for rows.Next() {
+		var n string
+		rows.Scan(&n)
+		names = append(names, n)
+	}
+	rows.Close()
+	if strings.Join(names, ",") != "jane,john" {
+		t.Errorf("unexpected rows: %v", names)
+	}
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO users VALUES (1) -- FAIL"); err == nil {
+		t.Error("expected exec error")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	end()
+
+	tr := exp.next(t)
+	var got []string
+	for _, s := range tr.Spans[1:] {
+		got = append(got, s.Name)
+		if s.ParentID != tr.Root.ID || s.Kind != flowtracker.SpanKindClient || s.Tags["db.system"] != "fakedb" {
+			t.Errorf("unexpected span %q: %+v", s.Name, s)
+		}
+	}
+	want := "DB: Prepare,DB: Exec,DB: Prepare,DB: Query,DB: Prepare,DB: Exec,DB: Begin,DB: Commit"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("unexpected spans\n got: %v\nwant: %v", strings.Join(got, ","), want)
+	}
+
+	update := tr.Spans[2]
+	if update.Tags["db.query"] != "UPDATE users SET email = ? WHERE id = ?" {
+		t.Errorf("expected normalized statement, got %q", update.Tags["db.query"])
+	}
+	if update.Tags["db.operation"] != "UPDATE" || update.Tags["db.rows_affected"] != "3" {
+		t.Errorf("unexpected exec tags: %v", update.Tags)
+	}
+	failed := tr.Spans[6]
+	if failed.Tags["error"] != "true" || failed.Tags["error.message"] != "duplicate key" {
+		t.Errorf("expected error tags, got %v", failed.Tags)
+	}
+}
+
+func TestQuery_SpanCoversRows(t *testing.T) {
+	db := OpenDB(fakeConnector{drv: &fakeDriver{}})
+	defer db.Close()
+
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp))
+	ctx, end := tracer.StartTrace(context.Background(), "GET /users")
+
+	rows, err := db.QueryContext(ctx, "SELECT name FROM users")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	rows.Next()
+	reading := time.Now()
+	for rows.Next() {
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, "SELECT name FROM users -- FAIL ROWS")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	for rows.Next() {
+	}
+	if rows.Err() == nil {
+		t.Error("expected the iteration to fail")
+	}
+	rows.Close()
+	end()
+
+	tr := exp.next(t)
+	query, failed := tr.Spans[2], tr.Spans[4]
+	if query.Name != "DB: Query" || query.EndTime.Before(reading) || query.Tags["error"] != "" {
+		t.Errorf("expected the query span to end after reading the rows, got %+v", query)
+	}
+	if failed.Tags["error"] != "true" || failed.Tags["error.message"] != "connection reset" {
+		t.Errorf("expected the iteration error on the query span, got %v", failed.Tags)
+	}
+}
+
+func TestOpenDB_NoTrace(t *testing.T) {
+	drv := &fakeDriver{}
+	db := OpenDB(fakeConnector{drv: drv})
+	defer db.Close()
+
+	// Without a trace in the context the wrapper is transparent
+	if _, err := db.ExecContext(context.Background(), "DELETE FROM sessions"); err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	if _, err := db.PrepareContext(context.Background(), "FAIL PREPARE"); err == nil {
+		t.Error("expected prepare error")
+	}
+	if len(drv.queries) != 1 || drv.queries[0] != "DELETE FROM sessions" {
+		t.Errorf("unexpected statements reached the driver: %v", drv.queries)
+	}
+}
+
+func TestOpenDB_RawQuery(t *testing.T) {
+	db := OpenDB(fakeConnector{drv: &fakeDriver{}}, WithRawQuery())
+	defer db.Close()
+
+	exp := make(chanExporter, 1)
+	tracer := flowtracker.NewTracer(flowtracker.WithExporter(exp))
+	ctx, end := tracer.StartTrace(context.Background(), "job")
+	if _, err := db.ExecContext(ctx, "DELETE FROM sessions WHERE age > 30"); err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	end()
+
+	tr := exp.next(t)
+	if got := tr.Spans[2].Tags["db.query"]; got != "DELETE FROM sessions WHERE age > 30" {
+		t.Errorf("expected raw statement, got %q", got)
+	}
+}